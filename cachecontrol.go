@@ -0,0 +1,94 @@
+package httpsy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl is a middleware that declares how responses may be cached
+// by composing the Cache-Control header and setting a matching Expires header.
+// It is the counterpart of NoCache. Headers are only set on responses to safe methods,
+// and not if the Cache-Control header was already set by a preceding middleware.
+// The handler may still override them.
+//
+// A typical configuration for versioned static assets might look like this:
+//  httpsy.CacheControl{
+//      Public:    true,
+//      MaxAge:    365 * 24 * time.Hour,
+//      Immutable: true,
+//  }
+type CacheControl struct {
+	// Public allows shared caches such as proxies and CDNs to store the response.
+	Public bool `json:"public" yaml:"public"`
+
+	// Private only allows the user agent to store the response.
+	// It must not be combined with Public.
+	Private bool `json:"private" yaml:"private"`
+
+	// MaxAge is how long the response stays fresh. It is rounded down to seconds.
+	// The Expires header is only set if MaxAge is set.
+	MaxAge time.Duration `json:"maxAge" yaml:"maxAge"`
+
+	// SMaxAge overrides MaxAge for shared caches (optional).
+	SMaxAge time.Duration `json:"sMaxAge,omitempty" yaml:"sMaxAge,omitempty"`
+
+	// MustRevalidate forbids caches from serving the response once it is stale.
+	MustRevalidate bool `json:"mustRevalidate" yaml:"mustRevalidate"`
+
+	// NoTransform forbids intermediaries from transforming the response, such as recompressing images.
+	NoTransform bool `json:"noTransform" yaml:"noTransform"`
+
+	// Immutable tells user agents that the response never changes while it is fresh,
+	// so that it is not revalidated when the user reloads the page.
+	Immutable bool `json:"immutable" yaml:"immutable"`
+}
+
+// String returns the value of the Cache-Control header.
+func (cc CacheControl) String() string {
+	var directives []string
+	if cc.Public {
+		directives = append(directives, "public")
+	}
+	if cc.Private {
+		directives = append(directives, "private")
+	}
+	if cc.MaxAge > 0 {
+		directives = append(directives, "max-age="+strconv.FormatInt(int64(cc.MaxAge/time.Second), 10))
+	}
+	if cc.SMaxAge > 0 {
+		directives = append(directives, "s-maxage="+strconv.FormatInt(int64(cc.SMaxAge/time.Second), 10))
+	}
+	if cc.MustRevalidate {
+		directives = append(directives, "must-revalidate")
+	}
+	if cc.NoTransform {
+		directives = append(directives, "no-transform")
+	}
+	if cc.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// Handle returns a middleware handler that applies the cache configuration.
+func (cc *CacheControl) Handle(next http.Handler) http.Handler {
+	// sanity checks
+	if cc.Public && cc.Private {
+		panic("cachecontrol: both public and private")
+	}
+
+	cacheControl := cc.String()
+	maxAge := cc.MaxAge
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := w.Header(); Safe(r) && cacheControl != "" && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", cacheControl)
+			if maxAge > 0 {
+				h.Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,56 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	cc := CacheControl{
+		Public:         true,
+		MaxAge:         time.Hour,
+		SMaxAge:        10 * time.Minute,
+		MustRevalidate: true,
+		Immutable:      true,
+	}
+
+	x := cc.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	t.Run("GET", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		x.ServeHTTP(w, r)
+
+		if v := w.Header().Get("Cache-Control"); v != "public, max-age=3600, s-maxage=600, must-revalidate, immutable" {
+			t.Fatal(v)
+		}
+
+		expires, err := http.ParseTime(w.Header().Get("Expires"))
+		if err != nil {
+			t.Fatal(err)
+		} else if d := time.Until(expires); d < 59*time.Minute || d > time.Hour {
+			t.Fatal(d)
+		}
+	})
+
+	t.Run("POST", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		x.ServeHTTP(w, r)
+		if w.Header().Get("Cache-Control") != "" || w.Header().Get("Expires") != "" {
+			t.Fatal(w.Header())
+		}
+	})
+
+	t.Run("AlreadySet", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		w.Header().Set("Cache-Control", "no-store")
+		r := httptest.NewRequest("GET", "/", nil)
+		x.ServeHTTP(w, r)
+		if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Expires") != "" {
+			t.Fatal(w.Header())
+		}
+	})
+}
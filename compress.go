@@ -0,0 +1,329 @@
+package httpsy
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// DefaultCompressMinSize is a reasonable minimum size in bytes of a response body to pass to Compress.
+// Smaller responses are not worth the overhead.
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressTypes are the content types that Compress compresses if none are given.
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// Compress is a middleware that compresses response bodies with gzip or deflate,
+// depending on the Accept-Encoding header of the request. gzip is preferred if both are accepted equally.
+// The level is a compression level of the compress/flate package, such as flate.DefaultCompression.
+//
+// Only responses with one of the given content types are compressed,
+// which may contain wildcards such as text/*. DefaultCompressTypes is used if types is empty.
+// This excludes content that is already compressed, such as images and archives.
+// Responses that already have a Content-Encoding, partial content responses,
+// and responses smaller than minSize bytes are not compressed either.
+// The start of the body is buffered until minSize is reached to make that decision,
+// unless the handler flushes the response first, in which case it is compressed regardless of size.
+// The Content-Length header is removed from compressed responses and Accept-Encoding is added to Vary.
+//
+// The middleware responds with HTTP 406 not acceptable if the request forbids the identity encoding
+// with identity;q=0 or *;q=0 while accepting neither gzip nor deflate.
+//
+//  mux.Handle("/", httpsy.Compress(flate.DefaultCompression, httpsy.DefaultCompressMinSize)(h))
+func Compress(level, minSize int, types ...string) func(http.Handler) http.Handler {
+	if _, err := zlib.NewWriterLevel(io.Discard, level); err != nil {
+		panic(err)
+	}
+
+	if len(types) == 0 {
+		types = DefaultCompressTypes
+	}
+
+	patterns := make([]string, len(types))
+	for i, t := range types {
+		patterns[i] = strings.ToLower(t)
+	}
+
+	gzipPool := &sync.Pool{New: func() interface{} {
+		zw, _ := gzip.NewWriterLevel(io.Discard, level)
+		return zw
+	}}
+	zlibPool := &sync.Pool{New: func() interface{} {
+		zw, _ := zlib.NewWriterLevel(io.Discard, level)
+		return zw
+	}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding, identity := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" {
+				if !identity {
+					Error(w, r, httpsyproblem.StatusNotAcceptable)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				patterns:       patterns,
+				minSize:        minSize,
+				gzipPool:       gzipPool,
+				zlibPool:       zlibPool,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the preferred supported content coding, if any,
+// and whether the identity coding is acceptable.
+func negotiateEncoding(acceptEncoding string) (encoding string, identity bool) {
+	qs := map[string]float64{}
+	for _, v := range parseQualityValues(strings.ToLower(acceptEncoding)) {
+		if _, exists := qs[v.value]; !exists {
+			qs[v.value] = v.q
+		}
+	}
+
+	q := func(coding string, fallback float64) float64 {
+		if v, ok := qs[coding]; ok {
+			return v
+		} else if v, ok := qs["*"]; ok {
+			return v
+		}
+		return fallback
+	}
+
+	gz, df := q("gzip", 0), q("deflate", 0)
+	if gz > 0 && gz >= df {
+		encoding = "gzip"
+	} else if df > 0 {
+		encoding = "deflate"
+	}
+	return encoding, q("identity", 1) > 0
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding  string
+	patterns  []string
+	minSize   int
+	gzipPool  *sync.Pool
+	zlibPool  *sync.Pool
+	code      int
+	buf       []byte
+	decided   bool
+	zw        io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if statusCode < 200 {
+		// pass informational responses through
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	if w.code == 0 {
+		w.code = statusCode
+		if !bodyAllowedForStatus(statusCode) {
+			w.decide(false)
+		}
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) >= w.minSize {
+			if err := w.decide(false); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide determines whether to compress the response based on the buffered start of the body,
+// writes the header and flushes the buffer.
+func (w *compressWriter) decide(flushing bool) error {
+	w.decided = true
+
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	h := w.Header()
+	if len(w.buf) > 0 && h.Get("Content-Type") == "" {
+		// sniff the content type like the http.Server would
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if w.compressible(flushing) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "gzip" {
+			zw := w.gzipPool.Get().(*gzip.Writer)
+			zw.Reset(w.ResponseWriter)
+			w.zw = zw
+		} else {
+			// the deflate content coding is the zlib format, not raw deflate
+			zw := w.zlibPool.Get().(*zlib.Writer)
+			zw.Reset(w.ResponseWriter)
+			w.zw = zw
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	} else if w.zw != nil {
+		_, err := w.zw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressWriter) compressible(flushing bool) bool {
+	h := w.Header()
+	if !bodyAllowedForStatus(w.code) || w.code == http.StatusPartialContent {
+		return false
+	} else if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	} else if !flushing && len(w.buf) < w.minSize {
+		return false
+	}
+
+	mediaType, _ := cutString(strings.ToLower(h.Get("Content-Type")), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, pattern := range w.patterns {
+		if mediaRangeMatch(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.code == 0 && len(w.buf) == 0 {
+			// nothing to flush yet, and the status code is unknown
+			return
+		}
+		_ = w.decide(true)
+	}
+
+	if gz, ok := w.zw.(*gzip.Writer); ok {
+		_ = gz.Flush()
+	} else if zl, ok := w.zw.(*zlib.Writer); ok {
+		_ = zl.Flush()
+	}
+
+	if f, ok := flusher(w.ResponseWriter); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the response after the handler has returned.
+func (w *compressWriter) close() {
+	if !w.decided && (w.code != 0 || len(w.buf) > 0) {
+		_ = w.decide(false)
+	}
+
+	switch zw := w.zw.(type) {
+	case *gzip.Writer:
+		_ = zw.Close()
+		w.gzipPool.Put(zw)
+	case *zlib.Writer:
+		_ = zw.Close()
+		w.zlibPool.Put(zw)
+	}
+	w.zw = nil
+}
+
+// DecompressRequest is a middleware that transparently decompresses request bodies
+// that are sent with Content-Encoding gzip or deflate, so that handlers read the decompressed bytes.
+// The Content-Encoding and Content-Length headers are removed and r.ContentLength is set to -1
+// because the decompressed length is unknown. Bodies with other encodings are passed on as is.
+//
+// The middleware responds with HTTP 400 bad request if the body does not start with a valid header
+// for its encoding. Corruption further into the stream is reported as a read error to the handler.
+// Limit the size of the decompressed body to protect against decompression bombs.
+func DecompressRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var zr io.ReadCloser
+		var err error
+		switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+		case "gzip", "x-gzip":
+			zr, err = gzip.NewReader(r.Body)
+		case "deflate":
+			zr, err = zlib.NewReader(r.Body)
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err != nil {
+			Error(w, r, httpsyproblem.Wrap(http.StatusBadRequest, err))
+			return
+		}
+		defer zr.Close()
+
+		r2 := r.Clone(r.Context())
+		r2.Header.Del("Content-Encoding")
+		r2.Header.Del("Content-Length")
+		r2.ContentLength = -1
+		r2.Body = &decompressedBody{zr, r.Body}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+	_ = b.ReadCloser.Close()
+	return b.body.Close()
+}
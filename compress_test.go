@@ -0,0 +1,213 @@
+package httpsy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+
+	endpoint := func(contentType, body string) http.Handler {
+		return Compress(flate.DefaultCompression, DefaultCompressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			io.WriteString(w, body)
+		}))
+	}
+
+	for _, tt := range []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		code           int
+		encoding       string
+	}{
+		{"gzip", "gzip, deflate", "text/plain", large, http.StatusOK, "gzip"},
+		{"deflate", "gzip;q=0.5, deflate", "application/json", large, http.StatusOK, "deflate"},
+		{"wildcard", "*", "text/html; charset=utf-8", large, http.StatusOK, "gzip"},
+		{"small", "gzip", "text/plain", "hello", http.StatusOK, ""},
+		{"image", "gzip", "image/png", large, http.StatusOK, ""},
+		{"none", "", "text/plain", large, http.StatusOK, ""},
+		{"identity rejected", "br, identity;q=0", "text/plain", large, http.StatusNotAcceptable, ""},
+		{"all rejected", "*;q=0", "text/plain", large, http.StatusNotAcceptable, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			endpoint(tt.contentType, tt.body).ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Fatal(w.Code)
+			} else if w.Code != http.StatusOK {
+				return
+			} else if ce := w.Header().Get("Content-Encoding"); ce != tt.encoding {
+				t.Fatal(ce)
+			} else if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Fatal(w.Header())
+			}
+
+			var body io.Reader = w.Body
+			switch tt.encoding {
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			case "deflate":
+				zr, err := zlib.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+
+			if tt.encoding != "" && w.Header().Get("Content-Length") != "" {
+				t.Fatal("Content-Length not removed")
+			}
+
+			if b, err := io.ReadAll(body); err != nil || string(b) != tt.body {
+				t.Fatal(len(b), err)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	x := Compress(flate.BestSpeed, DefaultCompressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: 2\n\n")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	x.ServeHTTP(w, r)
+
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal(w.Flushed, w.Header())
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	} else if b, err := io.ReadAll(zr); err != nil || string(b) != "data: 1\n\ndata: 2\n\n" {
+		t.Fatal(string(b), err)
+	}
+}
+
+func TestCompressMinSize(t *testing.T) {
+	x := Compress(flate.DefaultCompression, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	x.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal(w.Header())
+	} else if zr, err := gzip.NewReader(w.Body); err != nil {
+		t.Fatal(err)
+	} else if b, err := io.ReadAll(zr); err != nil || string(b) != "hello" {
+		t.Fatal(string(b), err)
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	x := Compress(flate.DefaultCompression, DefaultCompressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello")
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Fatal(v)
+			}
+		}()
+		x.ServeHTTP(w, r)
+	}()
+
+	// the buffered prefix is flushed and the writer is released
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "hello" {
+		t.Fatal(w.Header(), w.Body.String())
+	}
+}
+
+func TestCompressNoContent(t *testing.T) {
+	x := Compress(flate.DefaultCompression, DefaultCompressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	x.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Fatal(w.Code, w.Header())
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	x := DecompressRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 || r.Header.Get("Content-Encoding") != "" {
+			t.Fatal(r.ContentLength, r.Header)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(b)
+	}))
+
+	var gz, zz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = io.WriteString(zw, "hello gzip")
+	_ = zw.Close()
+	zlw := zlib.NewWriter(&zz)
+	_, _ = io.WriteString(zlw, "hello deflate")
+	_ = zlw.Close()
+
+	for _, tt := range []struct {
+		encoding string
+		body     []byte
+		code     int
+		expected string
+	}{
+		{"gzip", gz.Bytes(), http.StatusOK, "hello gzip"},
+		{"deflate", zz.Bytes(), http.StatusOK, "hello deflate"},
+		{"gzip", []byte("not gzip"), http.StatusBadRequest, ""},
+		{"deflate", []byte("not deflate"), http.StatusBadRequest, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		r.Header.Set("Content-Encoding", tt.encoding)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.encoding, w.Code)
+		} else if tt.code == http.StatusOK && w.Body.String() != tt.expected {
+			t.Fatal(tt.encoding, w.Body.String())
+		}
+	}
+}
@@ -3,8 +3,41 @@ package httpsy
 import (
 	"net/http"
 	"net/textproto"
+	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// CORSVary controls when the CORS middleware adds Origin to the Vary header.
+type CORSVary int
+
+const (
+	// CORSVaryAlways adds Origin to the Vary header for every request with an Origin header.
+	// This is always safe for caches and is the default.
+	CORSVaryAlways CORSVary = iota
+
+	// CORSVaryOnMatch adds Origin to the Vary header only if the origin is allowed.
+	CORSVaryOnMatch
+
+	// CORSVaryNever never adds Origin to the Vary header.
+	// Only use this if the cache in front of the server handles the Origin header by itself.
+	CORSVaryNever
+)
+
+// CORSMatchMode controls how the CORS middleware matches origins against AllowOrigins.
+type CORSMatchMode int
+
+const (
+	// CORSMatchGlob matches origins using path.Match. This is the default.
+	CORSMatchGlob CORSMatchMode = iota
+
+	// CORSMatchExact matches origins by string comparison.
+	CORSMatchExact
+
+	// CORSMatchRegex matches origins against regular expressions that must match the whole origin.
+	CORSMatchRegex
 )
 
 // CORS is a middleware for Cross-Origin Resource Sharing.
@@ -16,6 +49,11 @@ import (
 // the same domain (Same Origin Policy). CORS instructs the browser under what conditions
 // to relax this policy and allow scripts to access resources across domains.
 //
+// The CORS headers are set before the next handler is called, so they are also present on
+// error responses that are produced further down the chain, allowing scripts to read the error.
+// Therefore place CORS before middleware that may reject requests, such as authentication,
+// which also ensures that preflight requests are answered without credentials.
+//
 // A typical configuration might look like this:
 //  httpsy.CORS{
 // 	   AllowHeaders: []string{"X-Requested-With", "Content-Type", "Authorization"},
@@ -37,14 +75,28 @@ type CORS struct {
 	// An empty slice reflects the Access-Control-Request-Method header.
 	AllowMethods []string `json:"allowMethods,omitempty" yaml:"allowMethods,omitempty"`
 
+	// AllowMethodsFromHandler sets the Access-Control-Allow-Methods header
+	// to the Allow header set by the next handler in response to the preflight request.
+	// It only takes effect if AllowMethods is empty and OptionsPassthrough is set,
+	// so the middleware must be placed before the handler that dispatches on the method.
+	// The Access-Control-Request-Method header is reflected if the handler sets no Allow header.
+	AllowMethodsFromHandler bool `json:"allowMethodsFromHandler" yaml:"allowMethodsFromHandler"`
+
 	// AllowOrigins lists all origins that the user agent is allowed to fetch from.
-	// The request Origin header is matched against each element using path.Match.
+	// The request Origin header is matched case-insensitively against each element
+	// as specified by MatchMode, which defaults to path.Match.
 	// The Access-Control-Allow-Origin header is set to Origin if a match is found.
+	// The Origin is reflected exactly as sent by the user agent, even though it is matched case-insensitively.
+	// This is correct because an origin consists only of the scheme, host and port,
+	// which are all case-insensitive.
 	// No CORS headers will be set if no match was found.
 	// The ACAO header is set to "*" if the slice is empty (not recommended).
 	// This field is ignored if AllowOriginFunc is set.
 	AllowOrigins []string `json:"allowOrigins,omitempty" yaml:"allowOrigins,omitempty"`
 
+	// MatchMode specifies how AllowOrigins is matched.
+	MatchMode CORSMatchMode `json:"matchMode" yaml:"matchMode"`
+
 	// AllowOriginFunc overrides the behaviour for origin matching.
 	// It must return the value of Access-Control-Allow-Origin and whether there was a match.
 	AllowOriginFunc func(r *http.Request) (origin string, ok bool) `json:"-" yaml:"-"`
@@ -56,9 +108,28 @@ type CORS struct {
 	// It defaults to -1 if not set.
 	MaxAge int `json:"maxAge" yaml:"maxAge"`
 
+	// Vary controls when Origin is added to the Vary header.
+	// It defaults to CORSVaryAlways.
+	Vary CORSVary `json:"vary" yaml:"vary"`
+
 	// OptionsPassthrough specifies that the handler should continue to the next one
 	// after the preflight CORS rules have been applied.
+	//
+	// The outcome of a preflight request is as follows:
+	//  origin matches, OptionsPassthrough unset:      answered with PreflightStatus
+	//  origin matches, OptionsPassthrough set:        CORS headers set, next handler called
+	//  no match, RejectUnmatchedPreflight unset:      next handler called without CORS headers
+	//  no match, RejectUnmatchedPreflight set:        403 forbidden
 	OptionsPassthrough bool `json:"optionsPassthrough" yaml:"optionsPassthrough"`
+
+	// PreflightStatus is the status code of answered preflight requests,
+	// which is either 200 OK or 204 No Content. It defaults to 200 OK.
+	PreflightStatus int `json:"preflightStatus,omitempty" yaml:"preflightStatus,omitempty"`
+
+	// RejectUnmatchedPreflight responds with HTTP 403 forbidden to preflight requests
+	// from origins that do not match, instead of passing them to the next handler,
+	// which may not handle OPTIONS and respond with a confusing 405 method not allowed.
+	RejectUnmatchedPreflight bool `json:"rejectUnmatchedPreflight" yaml:"rejectUnmatchedPreflight"`
 }
 
 // Handle returns a middleware handler that applies the CORS configuration.
@@ -71,6 +142,13 @@ func (cors *CORS) Handle(next http.Handler) http.Handler {
 		allowOrigins  []string
 	)
 
+	preflightStatus := cors.PreflightStatus
+	if preflightStatus == 0 {
+		preflightStatus = http.StatusOK
+	} else if preflightStatus != http.StatusOK && preflightStatus != http.StatusNoContent {
+		panic("cors: preflight status must be 200 or 204")
+	}
+
 	if cors.MaxAge > 0 {
 		maxAge = strconv.Itoa(int(cors.MaxAge))
 	}
@@ -79,6 +157,35 @@ func (cors *CORS) Handle(next http.Handler) http.Handler {
 		allowOrigins = append(allowOrigins, strings.ToLower(s))
 	}
 
+	matchOrigin := func(origin string) bool {
+		return stringsMatch(allowOrigins, origin)
+	}
+
+	switch cors.MatchMode {
+	case CORSMatchExact:
+		matchOrigin = func(origin string) bool {
+			for _, s := range allowOrigins {
+				if s == origin {
+					return true
+				}
+			}
+			return false
+		}
+	case CORSMatchRegex:
+		regexps := make([]*regexp.Regexp, 0, len(cors.AllowOrigins))
+		for _, s := range cors.AllowOrigins {
+			regexps = append(regexps, regexp.MustCompile("(?i)^(?:"+s+")$"))
+		}
+		matchOrigin = func(origin string) bool {
+			for _, re := range regexps {
+				if re.MatchString(origin) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
 			h           = w.Header()
@@ -89,22 +196,32 @@ func (cors *CORS) Handle(next http.Handler) http.Handler {
 		)
 
 		if isCORS {
-			h.Add("Vary", "Origin")
+			if cors.Vary == CORSVaryAlways {
+				h.Add("Vary", "Origin")
+			}
 
 			if cors.AllowOriginFunc != nil {
 				origin, isCORS = cors.AllowOriginFunc(r)
 			} else if len(allowOrigins) == 0 {
 				origin = "*"
 			} else {
-				isCORS = stringsMatch(allowOrigins, strings.ToLower(origin))
+				isCORS = matchOrigin(strings.ToLower(origin))
 			}
 		}
 
 		if !isCORS {
+			if isPreflight && cors.RejectUnmatchedPreflight {
+				Error(w, r, httpsyproblem.StatusForbidden)
+				return
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		if cors.Vary == CORSVaryOnMatch {
+			h.Add("Vary", "Origin")
+		}
+
 		h.Set("Access-Control-Allow-Origin", origin)
 
 		if cors.AllowCredentials && origin != "*" {
@@ -134,12 +251,42 @@ func (cors *CORS) Handle(next http.Handler) http.Handler {
 			h.Set("Access-Control-Max-Age", maxAge)
 
 			if !cors.OptionsPassthrough {
-				w.Header().Add("Content-Length", "0")
-				w.WriteHeader(http.StatusOK)
+				if preflightStatus == http.StatusOK {
+					w.Header().Add("Content-Length", "0")
+				}
+				w.WriteHeader(preflightStatus)
 				return
 			}
+
+			if allowMethods == "" && cors.AllowMethodsFromHandler {
+				w = &corsAllowWriter{ResponseWriter: w}
+			}
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// corsAllowWriter copies the Allow header to Access-Control-Allow-Methods
+// before the header is written.
+type corsAllowWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *corsAllowWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if allow := w.Header().Get("Allow"); allow != "" {
+			w.Header().Set("Access-Control-Allow-Methods", allow)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *corsAllowWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -154,3 +154,190 @@ func TestCORSDefaults(t *testing.T) {
 		"Content-Length":               "0",
 	})
 }
+
+func TestCORSAllowMethodsFromHandler(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	cors := CORS{
+		AllowMethodsFromHandler: true,
+		OptionsPassthrough:      true,
+	}
+
+	x := cors.Handle(endpoint)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+
+	x.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatal()
+	}
+
+	assertHeaders(t, w.Header(), map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS",
+	})
+}
+
+func TestCORSVary(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, tt := range []struct {
+		vary           CORSVary
+		match, noMatch string
+	}{
+		{CORSVaryAlways, "Origin", "Origin"},
+		{CORSVaryOnMatch, "Origin", ""},
+		{CORSVaryNever, "", ""},
+	} {
+		cors := CORS{
+			AllowOrigins: []string{"https://example.com"},
+			Vary:         tt.vary,
+		}
+
+		x := cors.Handle(endpoint)
+
+		for origin, vary := range map[string]string{
+			"https://example.com": tt.match,
+			"https://evil.com":    tt.noMatch,
+		} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Origin", origin)
+			x.ServeHTTP(w, r)
+			if w.Header().Get("Vary") != vary {
+				t.Fatal(tt.vary, origin, w.Header().Get("Vary"))
+			}
+		}
+	}
+}
+
+func TestCORSMatchMode(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, tt := range []struct {
+		mode    CORSMatchMode
+		origins []string
+		allowed map[string]bool
+	}{
+		{CORSMatchGlob, []string{"https://*.example.com"}, map[string]bool{
+			"https://api.example.com": true,
+			"https://*.example.com":   true,
+			"https://example.com":     false,
+		}},
+		{CORSMatchExact, []string{"https://*.example.com"}, map[string]bool{
+			"https://api.example.com": false,
+			"https://*.example.com":   true,
+		}},
+		{CORSMatchRegex, []string{`https://[a-z]+\.example\.com`}, map[string]bool{
+			"https://API.example.com":      true,
+			"https://*.example.com":        false,
+			"https://api.example.com.evil": false,
+		}},
+	} {
+		cors := CORS{AllowOrigins: tt.origins, MatchMode: tt.mode}
+		x := cors.Handle(endpoint)
+
+		for origin, allowed := range tt.allowed {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Origin", origin)
+			x.ServeHTTP(w, r)
+			if (w.Header().Get("Access-Control-Allow-Origin") != "") != allowed {
+				t.Fatal(tt.mode, origin)
+			}
+		}
+	}
+}
+
+func TestCORSMixedCaseOrigin(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	cors := CORS{AllowOrigins: []string{"https://API.example.com"}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "HTTPS://api.Example.COM")
+	cors.Handle(endpoint).ServeHTTP(w, r)
+
+	assertHeaders(t, w.Header(), map[string]string{
+		"Access-Control-Allow-Origin": "HTTPS://api.Example.COM",
+	})
+}
+
+func TestCORSErrorResponse(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	authenticate := func(username, password string) error {
+		return httpsyproblem.StatusUnauthorized
+	}
+
+	cors := CORS{AllowOrigins: []string{"https://example.com"}}
+
+	x := cors.Handle(BasicAuth("", authenticate)(endpoint))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Accept", "application/json")
+	x.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatal(w.Code)
+	}
+
+	assertHeaders(t, w.Header(), map[string]string{
+		"Access-Control-Allow-Origin": "https://example.com",
+		"Content-Type":                "application/problem+json; charset=utf-8",
+	})
+}
+
+func TestCORSPreflightOutcome(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+
+	for _, tt := range []struct {
+		origin      string
+		passthrough bool
+		reject      bool
+		code        int
+		acao        string
+	}{
+		{"https://example.com", false, true, http.StatusNoContent, "https://example.com"},
+		{"https://example.com", true, true, http.StatusMethodNotAllowed, "https://example.com"},
+		{"https://evil.com", true, false, http.StatusMethodNotAllowed, ""},
+		{"https://evil.com", true, true, http.StatusForbidden, ""},
+	} {
+		cors := CORS{
+			AllowOrigins:             []string{"https://example.com"},
+			OptionsPassthrough:       tt.passthrough,
+			PreflightStatus:          http.StatusNoContent,
+			RejectUnmatchedPreflight: tt.reject,
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("OPTIONS", "/", nil)
+		r.Header.Set("Origin", tt.origin)
+		r.Header.Set("Access-Control-Request-Method", "PUT")
+		cors.Handle(endpoint).ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatal(tt.origin, tt.passthrough, w.Code)
+		} else if acao := w.Header().Get("Access-Control-Allow-Origin"); acao != tt.acao {
+			t.Fatal(tt.origin, acao)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package httpsy
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentSecurityPolicyNonce(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`<script nonce="{{.Nonce}}">{{.Data}}</script>`))
+	renderer := TemplateRenderer{Template: tmpl, InjectNonce: true}
+
+	var nonce string
+	endpoint := ContentSecurityPolicy("script-src 'nonce-{nonce}'")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce = Nonce(r)
+			Render(renderer, w, r, http.StatusOK, "init()")
+		}),
+	)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	endpoint.ServeHTTP(w, r)
+
+	if nonce == "" {
+		t.Fatal("no nonce")
+	} else if csp := w.Header().Get("Content-Security-Policy"); csp != "script-src 'nonce-"+nonce+"'" {
+		t.Fatal(csp)
+	} else if !strings.HasPrefix(w.Body.String(), `<script nonce="`+nonce+`">`) {
+		t.Fatal(w.Body.String())
+	}
+}
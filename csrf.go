@@ -38,18 +38,41 @@ type CSRF struct {
 	// ExemptFunc reports whether the request should be exempt from CSRF validation (optional).
 	ExemptFunc func(*http.Request) bool `json:"-" yaml:"-"`
 
+	// ExemptBearerAuth exempts requests that carry an Authorization header with the Bearer scheme.
+	// This is safe because user agents never send bearer tokens automatically,
+	// so such requests cannot be forged by another site.
+	// The token itself must still be verified by an authentication middleware,
+	// which should reject the request if it is invalid.
+	// Never use this for the Basic scheme, because user agents do resend Basic credentials.
+	ExemptBearerAuth bool `json:"exemptBearerAuth" yaml:"exemptBearerAuth"`
+
 	// Expires is the duration that a CSRF token is valid (required).
 	Expires time.Duration `json:"expires" yaml:"expires"`
 
 	// FormKey is the name of the CSRF form value (optional).
 	FormKey string `json:"formKey,omitempty" yaml:"formKey,omitempty"`
 
+	// MaxMemory is the maximum number of bytes of a multipart form that are stored in memory
+	// when the form is parsed to extract the token (optional).
+	// The remainder is stored on disk in temporary files. It defaults to 32 MB.
+	MaxMemory int64 `json:"maxMemory,omitempty" yaml:"maxMemory,omitempty"`
+
 	// Secret is the secret key used to sign the CSRF token (required).
 	Secret string `json:"secret" yaml:"secret"`
 
 	// SessionFunc extracts the session ID from the request if there is one (required).
 	// No token will be generated and validation will fail if there is no session ID.
+	//
+	// Note that user agents do not send SameSite=Strict cookies on cross-site navigations,
+	// so a client arriving from another site may have no session on its first request
+	// and therefore receives no token. Set NewSessionFunc to handle this case.
 	SessionFunc func(*http.Request) (sessionID string, ok bool) `json:"-" yaml:"-"`
+
+	// NewSessionFunc is called on safe requests that have no session ID (optional).
+	// It may establish a new session, for example by setting a session cookie,
+	// and returns its ID so that a token is generated for it.
+	// This ensures that the first unsafe request of a new visitor carries a valid token.
+	NewSessionFunc func(http.ResponseWriter, *http.Request) (sessionID string, ok bool) `json:"-" yaml:"-"`
 }
 
 // Handle returns a middleware handler that applies the CSRF configuration.
@@ -94,6 +117,11 @@ func (csrf *CSRF) Handle(next http.Handler) http.Handler {
 			}
 		}
 
+		// bootstrap a session for first-time visitors
+		if !session && csrf.NewSessionFunc != nil && Safe(r) {
+			sessionID, session = csrf.NewSessionFunc(w, r)
+		}
+
 		// generate new token and hand it to the client
 		if session {
 			token := b64.EncodeToString(csrfCreateToken(secret, sessionID, csrf.Expires))
@@ -107,6 +135,8 @@ func (csrf *CSRF) Handle(next http.Handler) http.Handler {
 func (csrf CSRF) exempt(r *http.Request) bool {
 	if Safe(r) {
 		return true
+	} else if _, ok := BearerToken(r); ok && csrf.ExemptBearerAuth {
+		return true
 	} else if csrf.ExemptFunc != nil {
 		return csrf.ExemptFunc(r)
 	}
@@ -116,6 +146,11 @@ func (csrf CSRF) exempt(r *http.Request) bool {
 func (csrf CSRF) extractToken(r *http.Request) (token string) {
 	if v := r.Header.Get("X-CSRF-Token"); v != "" {
 		token = v
+	} else if csrf.FormKey == "" || !csrfFormContentType(r) {
+		// do not consume request bodies that are not forms
+		return
+	} else if err := csrf.parseForm(r); err != nil {
+		return
 	} else if v := r.PostFormValue(csrf.FormKey); v != "" {
 		token = v
 	} else if r.MultipartForm != nil {
@@ -127,6 +162,28 @@ func (csrf CSRF) extractToken(r *http.Request) (token string) {
 	return
 }
 
+// parseForm parses the request body so that the handler can still access the parsed form.
+// Parsing twice is harmless because the parse functions do nothing if the form is already parsed.
+func (csrf CSRF) parseForm(r *http.Request) error {
+	if requestMediaType(r) == "multipart/form-data" {
+		maxMemory := csrf.MaxMemory
+		if maxMemory <= 0 {
+			maxMemory = 32 << 20
+		}
+		return r.ParseMultipartForm(maxMemory)
+	}
+	return r.ParseForm()
+}
+
+func csrfFormContentType(r *http.Request) bool {
+	switch requestMediaType(r) {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		return true
+	default:
+		return false
+	}
+}
+
 func csrfCreateToken(secret []byte, sessionID string, d time.Duration) []byte {
 	buf := make([]byte, 16, 48)
 
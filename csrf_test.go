@@ -1,6 +1,10 @@
 package httpsy
 
 import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -81,3 +85,146 @@ func TestCSRFRequests(t *testing.T) {
 		}
 	})
 }
+
+func TestCSRFJSONBody(t *testing.T) {
+	endpoint := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}
+
+	csrf := CSRF{
+		Secret:      "my secret key",
+		FormKey:     "csrf-form-key",
+		Expires:     10 * time.Minute,
+		SessionFunc: func(_ *http.Request) (string, bool) { return "a", true },
+	}
+
+	x := csrf.Handle(http.HandlerFunc(endpoint))
+
+	token := base64.StdEncoding.EncodeToString(csrfCreateToken([]byte(csrf.Secret), "a", csrf.Expires))
+
+	t.Run("PUT-header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/", strings.NewReader(`{"csrf-form-key":"x"}`))
+		r.Header.Set("content-type", "application/json")
+		r.Header.Set("x-csrf-token", token)
+		x.ServeHTTP(w, r)
+		if w.Code != 200 || w.Body.String() != `{"csrf-form-key":"x"}` {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("PUT-no-token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/", strings.NewReader(`{}`))
+		r.Header.Set("content-type", "application/json")
+		x.ServeHTTP(w, r)
+		if w.Code != 403 || r.PostForm != nil {
+			t.Fatal(w.Code)
+		}
+	})
+}
+
+func TestCSRFNewSession(t *testing.T) {
+	endpoint := func(w http.ResponseWriter, r *http.Request) {}
+
+	csrf := CSRF{
+		Secret:  "my secret key",
+		Expires: 10 * time.Minute,
+		SessionFunc: func(r *http.Request) (string, bool) {
+			c, err := r.Cookie("session")
+			if err != nil {
+				return "", false
+			}
+			return c.Value, true
+		},
+		NewSessionFunc: func(w http.ResponseWriter, r *http.Request) (string, bool) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "b", SameSite: http.SameSiteStrictMode})
+			return "b", true
+		},
+	}
+
+	x := csrf.Handle(http.HandlerFunc(endpoint))
+
+	// first visit without a session cookie
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	x.ServeHTTP(w, r)
+	token := w.Header().Get("x-csrf-token")
+	cookies := w.Result().Cookies()
+	if w.Code != 200 || token == "" || len(cookies) != 1 {
+		t.Fatal(w.Code, token, cookies)
+	}
+
+	// the first post carries the new session and token
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/", nil)
+	r.AddCookie(cookies[0])
+	r.Header.Set("x-csrf-token", token)
+	x.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatal(w.Code)
+	}
+}
+
+func TestCSRFMultipartForm(t *testing.T) {
+	endpoint := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 10); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(w, r.MultipartForm.Value["message"][0])
+	}
+
+	csrf := CSRF{
+		Secret:      "my secret key",
+		FormKey:     "csrf-form-key",
+		MaxMemory:   1 << 10,
+		Expires:     10 * time.Minute,
+		SessionFunc: func(_ *http.Request) (string, bool) { return "a", true },
+	}
+
+	x := csrf.Handle(http.HandlerFunc(endpoint))
+
+	token := base64.StdEncoding.EncodeToString(csrfCreateToken([]byte(csrf.Secret), "a", csrf.Expires))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("csrf-form-key", token)
+	_ = mw.WriteField("message", "hello")
+	_ = mw.Close()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("content-type", mw.FormDataContentType())
+	x.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "hello" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestCSRFExemptBearerAuth(t *testing.T) {
+	endpoint := func(w http.ResponseWriter, r *http.Request) {}
+
+	csrf := CSRF{
+		Secret:           "my secret key",
+		Expires:          10 * time.Minute,
+		ExemptBearerAuth: true,
+		SessionFunc:      func(_ *http.Request) (string, bool) { return "a", true },
+	}
+
+	x := csrf.Handle(http.HandlerFunc(endpoint))
+
+	for auth, code := range map[string]int{
+		"Bearer abc":     200,
+		"bearer abc":     200,
+		"Basic Z29waGVy": 403,
+		"":               403,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Authorization", auth)
+		x.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Fatal(auth, w.Code)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package httpsy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// DecodeJSON decodes the JSON request body into dst.
+// It returns an HTTP 400 bad request problem if the body is not valid JSON
+// or does not match the type of dst, and ErrRequestTooLarge if the body exceeds the limit set by MaxBytes.
+func DecodeJSON(r *http.Request, dst interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return bodyReadError(err)
+	}
+	return nil
+}
+
+// DecodeForm parses the form of the request and decodes it into dst,
+// which must be a pointer to a struct.
+// Fields are matched by the name in the form struct tag, followed by the json struct tag,
+// followed by the field name. Fields tagged with "-" are skipped.
+// Strings, booleans, integers, floats and slices of those are supported.
+// It returns an HTTP 400 bad request problem if the form cannot be parsed
+// or a value cannot be converted to the type of its field,
+// and ErrRequestTooLarge if the body exceeds the limit set by MaxBytes.
+//
+//  var comment struct {
+//      Message string   `form:"message"`
+//      Tags    []string `form:"tag"`
+//  }
+//  err := httpsy.DecodeForm(r, &comment)
+func DecodeForm(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("httpsy: DecodeForm requires a pointer to a struct")
+	}
+
+	var err error
+	if requestMediaType(r) == "multipart/form-data" {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return bodyReadError(err)
+	}
+
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := formFieldName(field)
+		values, ok := r.Form[name]
+		if name == "-" || !ok {
+			continue
+		}
+
+		if err := setFormValue(v.Field(i), values); err != nil {
+			return httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("form value %q: %w", name, err))
+		}
+	}
+	return nil
+}
+
+// DecodeBody decodes the request body into dst according to the Content-Type header.
+// JSON bodies (application/json and any +json media type) are decoded by DecodeJSON
+// and form bodies (application/x-www-form-urlencoded and multipart/form-data) by DecodeForm.
+// It returns an HTTP 415 unsupported media type problem for any other content type.
+// This lets an endpoint serve HTML forms and API clients with the same code.
+func DecodeBody(r *http.Request, dst interface{}) error {
+	switch mediaType := requestMediaType(r); {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return DecodeJSON(r, dst)
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		return DecodeForm(r, dst)
+	default:
+		return httpsyproblem.StatusUnsupportedMediaType
+	}
+}
+
+func formFieldName(field reflect.StructField) string {
+	for _, key := range []string{"form", "json"} {
+		if tag, ok := field.Tag.Lookup(key); ok {
+			if name, _ := cutString(tag, ","); name != "" {
+				return name
+			}
+		}
+	}
+	return field.Name
+}
+
+func setFormValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setFormScalar(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setFormScalar(v, values[0])
+}
+
+func setFormScalar(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		// checkboxes send "on" when checked
+		b, err := strconv.ParseBool(s)
+		if s == "on" {
+			b, err = true, nil
+		}
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+func TestDecodeBody(t *testing.T) {
+	type comment struct {
+		Message string   `json:"message"`
+		Rating  int      `json:"rating"`
+		Public  bool     `json:"public"`
+		Tags    []string `json:"tags" form:"tag"`
+		Ignored string   `json:"-" form:"-"`
+	}
+
+	expected := comment{"hello", 5, true, []string{"a", "b"}, ""}
+
+	for _, tt := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"message":"hello","rating":5,"public":true,"tags":["a","b"]}`},
+		{"application/x-www-form-urlencoded", "message=hello&rating=5&public=on&tag=a&tag=b&Ignored=x"},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+
+		var c comment
+		if err := DecodeBody(r, &c); err != nil {
+			t.Fatal(tt.contentType, err)
+		} else if !reflect.DeepEqual(c, expected) {
+			t.Fatal(tt.contentType, c)
+		}
+	}
+}
+
+func TestDecodeBodyErrors(t *testing.T) {
+	var dst struct {
+		Rating int `form:"rating"`
+	}
+
+	for _, tt := range []struct {
+		contentType string
+		body        string
+		code        int
+	}{
+		{"text/plain", "hello", http.StatusUnsupportedMediaType},
+		{"application/json", "{", http.StatusBadRequest},
+		{"application/x-www-form-urlencoded", "rating=five", http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		if err := DecodeBody(r, &dst); httpsyproblem.StatusCode(err) != tt.code {
+			t.Fatal(tt.contentType, err)
+		}
+	}
+}
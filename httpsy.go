@@ -3,11 +3,21 @@
 package httpsy
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/askeladdk/httpsyproblem"
 )
@@ -17,35 +27,246 @@ func WithContextValue(r *http.Request, key, value interface{}) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), key, value))
 }
 
+type valueBag struct {
+	mu sync.RWMutex
+	m  map[interface{}]interface{}
+}
+
+// WithValueBag is a middleware that installs a value bag in the request context.
+// The value bag stores request-scoped values without allocating a new context for every value,
+// which is cheaper than WithContextValue when many middlewares store values.
+// The bag is safe for concurrent use.
+func WithValueBag(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(valueBagCtxKey).(*valueBag); !ok {
+			r = WithContextValue(r, valueBagCtxKey, &valueBag{m: map[interface{}]interface{}{}})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BagSet maps key to value in the value bag of the request.
+// It returns r unchanged if the request has a value bag.
+// Otherwise it returns a shallow copy of r with a new value bag.
+func BagSet(r *http.Request, key, value interface{}) *http.Request {
+	bag, ok := r.Context().Value(valueBagCtxKey).(*valueBag)
+	if !ok {
+		bag = &valueBag{m: map[interface{}]interface{}{}}
+		r = WithContextValue(r, valueBagCtxKey, bag)
+	}
+	bag.mu.Lock()
+	bag.m[key] = value
+	bag.mu.Unlock()
+	return r
+}
+
+// BagGet returns the value that is mapped to key in the value bag of the request,
+// or nil if there is none.
+func BagGet(r *http.Request, key interface{}) interface{} {
+	bag, ok := r.Context().Value(valueBagCtxKey).(*valueBag)
+	if !ok {
+		return nil
+	}
+	bag.mu.RLock()
+	defer bag.mu.RUnlock()
+	return bag.m[key]
+}
+
+// setParamValue returns a shallow copy of r with the parameter added.
+// The parameter map is copied on write so that requests sharing
+// a parent context never observe each other's parameters.
 func setParamValue(r *http.Request, key, value string) *http.Request {
-	if v := r.Context().Value(paramMapCtxKey); v != nil {
-		(*v.(*map[string]string))[key] = value
-		return r
+	params, _ := r.Context().Value(paramMapCtxKey).(map[string]string)
+	m := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		m[k] = v
 	}
-	m := map[string]string{key: value}
-	return WithContextValue(r, paramMapCtxKey, &m)
+	m[key] = value
+	return WithContextValue(r, paramMapCtxKey, m)
 }
 
 // RouteParamValue returns the value of an URL parameter
 // that was parsed by the RouteParam middleware.
+// Parameters are read from the request context and never cause the form to be parsed.
 func RouteParamValue(r *http.Request, key string) string {
-	if v := r.Context().Value(paramMapCtxKey); v != nil {
-		return (*v.(*map[string]string))[key]
+	params, _ := r.Context().Value(paramMapCtxKey).(map[string]string)
+	return params[key]
+}
+
+// ClientCert returns the client certificate that was verified by the RequireClientCert middleware,
+// or nil if there is none.
+func ClientCert(r *http.Request) *x509.Certificate {
+	cert, _ := r.Context().Value(clientCertCtxKey).(*x509.Certificate)
+	return cert
+}
+
+// ParseMediaType parses the Content-Type header of the request with mime.ParseMediaType.
+// The media type is lowercased and the parameter names, such as charset and boundary,
+// are lowercased map keys with unquoted values.
+// It returns an empty media type and no error if the header is absent,
+// and an HTTP 400 bad request problem if the header is malformed.
+//
+//  mediaType, params, err := httpsy.ParseMediaType(r)
+//  if mediaType == "multipart/form-data" {
+//      mr := multipart.NewReader(r.Body, params["boundary"])
+//  }
+func ParseMediaType(r *http.Request) (mediatype string, params map[string]string, err error) {
+	contentType := r.Header.Get("Content-Type")
+	if strings.TrimSpace(contentType) == "" {
+		return "", nil, nil
 	}
-	return ""
+	mediatype, params, err = mime.ParseMediaType(contentType)
+	if err != nil {
+		return mediatype, params, httpsyproblem.Wrap(http.StatusBadRequest, err)
+	}
+	return mediatype, params, nil
+}
+
+// BearerToken returns the token of an Authorization header with the Bearer scheme.
+// The scheme is matched case-insensitively and surrounding whitespace is ignored.
+// It returns false if the header is absent, has another scheme,
+// or if the token is empty or not valid token68 syntax as defined by RFC 7235.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token := cutString(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	} else if token = strings.TrimSpace(token); !isToken68(token) {
+		return "", false
+	}
+	return token, true
 }
 
 // ErrorHandlerFunc handles an error and generates an appropriate response.
 type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
 
+// DefaultErrorTemplate is a minimal HTML error page for HTMLErrorHandler.
+// Install it as the fallback template to serve HTML error pages to browsers:
+//  h = httpsy.SetErrorHandler(httpsy.HTMLErrorHandler(nil, httpsy.DefaultErrorTemplate))(h)
+var DefaultErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.StatusCode}} {{.StatusText}}</title></head>
+<body><h1>{{.StatusCode}} {{.StatusText}}</h1></body>
+</html>
+`))
+
 // Error replies to the request with the specified error message.
 // It will use the error handler set with SetErrorHandler or uses httpsyproblem.Serve otherwise.
+// See DefaultErrorTemplate to serve HTML error pages to browsers.
+// Common standard library errors are given a status code as described by StatusCode.
 func Error(w http.ResponseWriter, r *http.Request, err error) {
-	var errorHandler ErrorHandlerFunc = httpsyproblem.Serve
+	errorHandler(r)(w, r, stdlibError(err))
+}
+
+// ErrorWithHeaders is like Error but sets the headers on the response first,
+// so that headers which must accompany an error, such as Retry-After and WWW-Authenticate,
+// are sent together with the problem body.
+//
+//  httpsy.ErrorWithHeaders(w, r, httpsyproblem.StatusTooManyRequests, map[string]string{
+//      "Retry-After": "30",
+//  })
+func ErrorWithHeaders(w http.ResponseWriter, r *http.Request, err error, headers map[string]string) {
+	h := w.Header()
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	Error(w, r, err)
+}
+
+func errorHandler(r *http.Request) ErrorHandlerFunc {
 	if h, ok := r.Context().Value(keyErrorHandlerCtxKey).(ErrorHandlerFunc); ok {
-		errorHandler = h
+		return h
+	}
+	return httpsyproblem.Serve
+}
+
+// ErrorMapping maps an error to the error it is translated to by MapErrors.
+type ErrorMapping struct {
+	From error
+	To   error
+}
+
+// MapErrors returns an error mapper for SetErrorMapper that translates errors
+// to the error they are mapped to if they match according to errors.Is.
+// The mappings are tried in order and the first match wins,
+// which matters for errors that wrap more than one of the mapped errors.
+// Errors that do not match any mapping are returned as is.
+//
+//  httpsy.SetErrorMapper(httpsy.MapErrors(
+//      httpsy.ErrorMapping{From: sql.ErrNoRows, To: httpsyproblem.StatusNotFound},
+//  ))
+func MapErrors(mappings ...ErrorMapping) func(error) error {
+	return func(err error) error {
+		for _, m := range mappings {
+			if errors.Is(err, m.From) {
+				return m.To
+			}
+		}
+		return err
 	}
-	errorHandler(w, r, err)
+}
+
+// HTMLErrorHandler returns an error handler that renders an HTML error page
+// if the client explicitly accepts text/html and delegates to httpsyproblem.Serve otherwise.
+// The template is looked up in templates by status code and defaults to fallback.
+// Errors are also delegated to httpsyproblem.Serve if no template is found or if it fails to execute.
+// The templates are executed with a value that has the fields
+// StatusCode (int), StatusText (string) and Err (error).
+//
+// Install it with SetErrorHandler:
+//  h = httpsy.SetErrorHandler(httpsy.HTMLErrorHandler(templates, fallback))(h)
+func HTMLErrorHandler(templates map[int]*template.Template, fallback *template.Template) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		code := httpsyproblem.StatusCode(err)
+
+		tmpl := templates[code]
+		if tmpl == nil {
+			tmpl = fallback
+		}
+
+		if tmpl == nil || !acceptsHTML(r) {
+			httpsyproblem.Serve(w, r, err)
+			return
+		}
+
+		data := struct {
+			StatusCode int
+			StatusText string
+			Err        error
+		}{code, http.StatusText(code), err}
+
+		b := renderBufferPool.Get().(*bytes.Buffer)
+		b.Reset()
+		defer renderBufferPool.Put(b)
+
+		// serve the original error if the template fails so that the status code is preserved
+		if (TemplateRenderer{Template: tmpl, Name: tmpl.Name()}).Render(b, w.Header(), data) != nil {
+			w.Header().Del("Content-Type")
+			httpsyproblem.Serve(w, r, err)
+			return
+		}
+
+		w.WriteHeader(code)
+		_, _ = b.WriteTo(w)
+	}
+}
+
+// TimeRemaining returns the time left until the deadline of the request context,
+// so that handlers can decide whether to attempt an expensive operation.
+// It returns false if the context has no deadline.
+// The duration is negative if the deadline has passed.
+func TimeRemaining(r *http.Request) (time.Duration, bool) {
+	deadline, ok := r.Context().Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// ReceivedTime returns the time the request was received as recorded by the MarkReceived middleware.
+// It returns false if the time was not recorded.
+func ReceivedTime(r *http.Request) (time.Time, bool) {
+	t, ok := r.Context().Value(receivedTimeCtxKey).(time.Time)
+	return t, ok
 }
 
 // ShiftPath splits off the first component of p, which will be cleaned of
@@ -97,17 +318,294 @@ func Safe(r *http.Request) bool {
 	}
 }
 
+// DrainBody reads and discards at most maxBytes of the unread request body and closes it,
+// so that the connection can be reused for the next request.
+// It reports whether the body was fully consumed.
+//
+// The http.Server already discards up to 256 KiB of unread body after the handler returns.
+// DrainBody is only needed to keep connections alive for clients that send larger bodies
+// that the handler does not read, such as rejected uploads.
+func DrainBody(r *http.Request, maxBytes int64) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	n, err := io.CopyN(io.Discard, r.Body, maxBytes+1)
+	_ = r.Body.Close()
+	return n <= maxBytes && err == io.EOF
+}
+
+// RemoveHopByHopHeaders removes the hop-by-hop headers from h as defined by RFC 7230 section 6.1.
+// These are Connection, Keep-Alive, Proxy-Authenticate, Proxy-Authorization, Proxy-Connection,
+// TE, Trailer, Transfer-Encoding and Upgrade, as well as the headers listed in the Connection header.
+// Proxies must remove them before forwarding a request or response.
+func RemoveHopByHopHeaders(h http.Header) {
+	// taken from net/http/httputil.removeHopByHopHeaders
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// BodyBytes returns the request body that was buffered by the BufferBody middleware,
+// or nil if there is none. The returned slice must not be modified.
+func BodyBytes(r *http.Request) []byte {
+	body, _ := r.Context().Value(bodyBytesCtxKey).([]byte)
+	return body
+}
+
+// RewindBody replaces r.Body with a fresh reader over the body that was buffered
+// by the BufferBody middleware, so that the body can be read again after
+// a previous consumer read it. It does nothing if the body was not buffered.
+func RewindBody(r *http.Request) {
+	if body := BodyBytes(r); body != nil {
+		r.Body = &bufferedBody{bytes.NewReader(body)}
+	}
+}
+
+// PreferredLanguage returns the supported language that best matches
+// the Accept-Language request header, or the empty string if none match.
+// Languages are compared case-insensitively and a language with a region
+// matches its base language, so that en-US matches en and the other way around.
+// An exact match is preferred over a base language match.
+//
+//  lang := httpsy.PreferredLanguage(r, "en", "nl", "de-CH")
+func PreferredLanguage(r *http.Request, supported ...string) string {
+	base := func(tag string) string {
+		if i := strings.IndexByte(tag, '-'); i >= 0 {
+			return tag[:i]
+		}
+		return tag
+	}
+
+	accepts := parseQualityValues(r.Header.Get("Accept-Language"))
+
+	rejected := func(lang string) bool {
+		for _, accepted := range accepts {
+			if accepted.q == 0 && strings.EqualFold(accepted.value, lang) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, accepted := range accepts {
+		if accepted.q == 0 {
+			break
+		} else if accepted.value == "*" {
+			for _, lang := range supported {
+				if !rejected(lang) {
+					return lang
+				}
+			}
+		}
+		for _, lang := range supported {
+			if strings.EqualFold(accepted.value, lang) {
+				return lang
+			}
+		}
+		for _, lang := range supported {
+			if strings.EqualFold(base(accepted.value), base(lang)) {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// SetContentLanguage sets the Content-Language header to lang and adds Accept-Language
+// to the Vary header, so that caches store a separate copy for every language.
+func SetContentLanguage(w http.ResponseWriter, lang string) {
+	w.Header().Set("Content-Language", lang)
+	addVary(w.Header(), "Accept-Language")
+}
+
+// NegotiateLanguage returns the preferred language like PreferredLanguage
+// and advertises it with SetContentLanguage.
+// If no language matches, it returns the empty string and only adds Accept-Language to the Vary header,
+// because the choice of the fallback language still depends on the request header.
+//
+//  lang := httpsy.NegotiateLanguage(w, r, "en", "nl")
+//  if lang == "" {
+//      lang = "en"
+//  }
+func NegotiateLanguage(w http.ResponseWriter, r *http.Request, supported ...string) string {
+	lang := PreferredLanguage(r, supported...)
+	if lang != "" {
+		SetContentLanguage(w, lang)
+	} else {
+		addVary(w.Header(), "Accept-Language")
+	}
+	return lang
+}
+
+// AbsoluteURL returns the absolute URL of ref as seen by the client.
+// A relative ref is resolved against the request URL path.
+// The scheme is https if the request was made over TLS and http otherwise,
+// and the host is taken from the request Host.
+//
+// If trustProxy is set, the scheme and host are instead taken from the X-Forwarded-Proto and
+// X-Forwarded-Host headers if present. Only trust these headers when the server is behind a reverse proxy
+// that sets them or you will make it easy for attackers to inject links to other hosts.
+//
+//  w.Header().Set("Location", httpsy.AbsoluteURL(r, "/orders/"+orderID, true))
+func AbsoluteURL(r *http.Request, ref string, trustProxy bool) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if trustProxy {
+		if xfp := r.Header.Get("X-Forwarded-Proto"); xfp != "" {
+			scheme, _ = cutString(xfp, ",")
+			scheme = strings.ToLower(strings.TrimSpace(scheme))
+		}
+		if xfh := r.Header.Get("X-Forwarded-Host"); xfh != "" {
+			host, _ = cutString(xfh, ",")
+			host = strings.TrimSpace(host)
+		}
+	}
+
+	base := &url.URL{Scheme: scheme, Host: host, Path: r.URL.Path}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return base.String()
+	}
+	return base.ResolveReference(u).String()
+}
+
+// SafeRedirectTarget validates a redirect target that was supplied by the user,
+// such as the next query parameter of a login form, to prevent open redirects.
+// Relative references are accepted, except protocol-relative ones like //evil.com.
+// Absolute URLs are only accepted if their scheme is http or https
+// and their host is the request Host or one of allowedHosts, compared case-insensitively including the port.
+// Targets that contain backslashes or control characters, or that begin or end with whitespace,
+// are always rejected, because browsers interpret them inconsistently.
+// For example, browsers strip the leading space of " //evil.com" and follow it to another host.
+//
+//  next, ok := httpsy.SafeRedirectTarget(r, r.FormValue("next"))
+//  if !ok {
+//      next = "/"
+//  }
+//  http.Redirect(w, r, next, http.StatusSeeOther)
+func SafeRedirectTarget(r *http.Request, candidate string, allowedHosts ...string) (string, bool) {
+	if candidate == "" || strings.ContainsRune(candidate, '\\') || strings.TrimSpace(candidate) != candidate {
+		return "", false
+	}
+	for _, c := range candidate {
+		if c < 0x20 || c == 0x7f {
+			return "", false
+		}
+	}
+
+	u, err := url.Parse(candidate)
+	if err != nil {
+		return "", false
+	} else if u.Scheme == "" && u.Host == "" && u.User == nil && !strings.HasPrefix(candidate, "//") {
+		return candidate, true
+	} else if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", false
+	} else if strings.EqualFold(u.Host, r.Host) {
+		return candidate, true
+	}
+
+	for _, host := range allowedHosts {
+		if strings.EqualFold(u.Host, host) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// SetCookie adds a Set-Cookie header to the response with secure defaults.
+// HttpOnly is set and SameSite defaults to Lax if not specified.
+// Secure is set if the request was made over HTTPS, which is detected
+// from r.TLS or an X-Forwarded-Proto header with the value https.
+// See SetCookieWith for cookies that must be readable by scripts.
+//
+// An error is returned and no header is added if the cookie name or value contains invalid characters,
+// or if SameSite is None while the request was not made over HTTPS,
+// because browsers reject SameSite=None cookies that are not Secure.
+func SetCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) error {
+	return SetCookieWith(w, r, cookie, CookieOptions{})
+}
+
+// CookieOptions overrides the defaults of SetCookieWith.
+type CookieOptions struct {
+	// AllowScript leaves HttpOnly unset so that scripts can read the cookie,
+	// for example to send it back in a CSRF header.
+	AllowScript bool
+}
+
+// SetCookieWith is like SetCookie but lets the defaults be overridden by opts.
+//
+//  err := httpsy.SetCookieWith(w, r, &http.Cookie{Name: "theme", Value: "dark"}, httpsy.CookieOptions{
+//      AllowScript: true,
+//  })
+func SetCookieWith(w http.ResponseWriter, r *http.Request, cookie *http.Cookie, opts CookieOptions) error {
+	if !isCookieName(cookie.Name) {
+		return fmt.Errorf("httpsy: invalid cookie name %q", cookie.Name)
+	} else if !isCookieValue(cookie.Value) {
+		return fmt.Errorf("httpsy: invalid value for cookie %q", cookie.Name)
+	}
+
+	c := *cookie
+	c.HttpOnly = !opts.AllowScript
+	if c.SameSite == 0 || c.SameSite == http.SameSiteDefaultMode {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		c.Secure = true
+	} else if c.SameSite == http.SameSiteNoneMode {
+		return fmt.Errorf("httpsy: cookie %q with SameSite=None requires HTTPS", cookie.Name)
+	}
+
+	http.SetCookie(w, &c)
+	return nil
+}
+
+// Favicon returns a handler that serves a fixed favicon with long-lived cache headers,
+// so that browsers do not request it on every page load.
+// If data is empty, the handler responds with 204 no content instead,
+// which also stops browsers from repeatedly requesting it without cluttering the logs with 404s.
+//
+//  mux.Handle("/favicon.ico", httpsy.Favicon(icon, "image/x-icon"))
+func Favicon(data []byte, contentType string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=604800")
+		if len(data) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	})
+}
+
 // NoListing disables directory listing in an http.FileSystem.
 //
 // How to use:
 //  dir := httpsy.NoListing(http.Dir("."))
 //  mux.Mount("/", http.FileServer(dir))
 func NoListing(fs http.FileSystem) http.FileSystem {
-	return noListing{fs}
+	return noListing{fs, false}
+}
+
+// NoListingIndex is like NoListing but allows directories that contain an index.html file,
+// so that http.FileServer serves the index instead of responding with 404 not found.
+// Directories without an index are still not listed.
+func NoListingIndex(fs http.FileSystem) http.FileSystem {
+	return noListing{fs, true}
 }
 
 type noListing struct {
 	http.FileSystem
+	index bool
 }
 
 func (fs noListing) Open(name string) (http.File, error) {
@@ -116,10 +614,43 @@ func (fs noListing) Open(name string) (http.File, error) {
 	} else if stat, err := f.Stat(); err != nil {
 		_ = f.Close()
 		return nil, err
-	} else if stat.IsDir() {
+	} else if stat.IsDir() && !(fs.index && fs.hasIndex(name)) {
 		_ = f.Close()
 		return nil, os.ErrNotExist
 	} else {
 		return f, nil
 	}
 }
+
+func (fs noListing) hasIndex(dir string) bool {
+	f, err := fs.FileSystem.Open(path.Join(dir, "index.html"))
+	if err != nil {
+		return false
+	}
+	stat, err := f.Stat()
+	_ = f.Close()
+	return err == nil && !stat.IsDir()
+}
+
+// OverlayFS returns an http.FileSystem that opens files from the first layer that has them,
+// so that upper layers override files in lower layers.
+// It returns an error that satisfies os.IsNotExist only if none of the layers has the file.
+// Directories are not merged; a directory is served from the first layer that has it.
+//
+//  fs := httpsy.NoListing(httpsy.OverlayFS(http.Dir("theme"), http.FS(defaultAssets)))
+func OverlayFS(layers ...http.FileSystem) http.FileSystem {
+	return overlayFS(layers)
+}
+
+type overlayFS []http.FileSystem
+
+func (layers overlayFS) Open(name string) (http.File, error) {
+	for _, layer := range layers {
+		if f, err := layer.Open(name); err == nil {
+			return f, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, os.ErrNotExist
+}
@@ -1,9 +1,15 @@
 package httpsy
 
 import (
+	"context"
+	"crypto/tls"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/askeladdk/httpsyproblem"
 )
@@ -22,6 +28,21 @@ func TestProblemContentType(t *testing.T) {
 	}
 }
 
+func TestErrorWithHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	ErrorWithHeaders(w, r, httpsyproblem.StatusUnauthorized, map[string]string{
+		"WWW-Authenticate": `Bearer realm="api"`,
+	})
+
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"status":401`) {
+		t.Fatal(w.Code, w.Body.String())
+	} else if w.Header().Get("WWW-Authenticate") != `Bearer realm="api"` {
+		t.Fatal(w.Header())
+	}
+}
+
 func TestContextKeyTypeOf(t *testing.T) {
 	var k1 = keyErrorHandlerCtxKey
 	var k2 = paramMapCtxKey
@@ -37,3 +58,455 @@ func TestContextKeyTypeOf(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestHTMLErrorHandler(t *testing.T) {
+	templates := map[int]*template.Template{
+		http.StatusNotFound: template.Must(template.New("").Parse(`not found`)),
+		http.StatusGone:     template.Must(template.New("410").Parse(`gone`)),
+		http.StatusConflict: template.Must(template.New("409").Parse(`{{.Missing.Field}}`)),
+	}
+	fallback := template.Must(template.New("").Parse(`{{.StatusCode}} {{.StatusText}}`))
+
+	x := SetErrorHandler(HTMLErrorHandler(templates, fallback))
+
+	serve := func(err error, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		x(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, err)
+		})).ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("404", func(t *testing.T) {
+		w := serve(httpsyproblem.StatusNotFound, "text/html")
+		if w.Code != http.StatusNotFound || w.Body.String() != "not found" {
+			t.Fatal(w.Code, w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Fatal(w.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		w := serve(httpsyproblem.StatusInternalServerError, "text/html,application/xhtml+xml")
+		if w.Code != http.StatusInternalServerError || w.Body.String() != "500 Internal Server Error" {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("named", func(t *testing.T) {
+		w := serve(httpsyproblem.StatusGone, "text/html")
+		if w.Code != http.StatusGone || w.Body.String() != "gone" {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		w := serve(httpsyproblem.StatusConflict, "text/html")
+		if w.Code != http.StatusConflict || strings.Contains(w.Body.String(), "Missing") {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		w := serve(httpsyproblem.StatusNotFound, "text/html;q=0")
+		if w.Code != http.StatusNotFound || strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Fatal(w.Code, w.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		w := serve(httpsyproblem.StatusNotFound, "application/json")
+		if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/problem+json; charset=utf-8" {
+			t.Fatal(w.Code, w.Header().Get("Content-Type"))
+		}
+	})
+}
+
+func TestParamValueCopyOnWrite(t *testing.T) {
+	r0 := httptest.NewRequest("GET", "/", nil)
+	if RouteParamValue(r0, "a") != "" {
+		t.Fatal()
+	}
+
+	r1 := setParamValue(r0, "a", "1")
+	r2 := setParamValue(r1, "a", "2")
+	r3 := setParamValue(r1, "b", "3")
+
+	if RouteParamValue(r1, "a") != "1" || RouteParamValue(r1, "b") != "" {
+		t.Fatal("r1 mutated")
+	} else if RouteParamValue(r2, "a") != "2" {
+		t.Fatal("r2")
+	} else if RouteParamValue(r3, "a") != "1" || RouteParamValue(r3, "b") != "3" {
+		t.Fatal("r3")
+	}
+}
+
+func TestSetCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if err := SetCookie(w, r, &http.Cookie{Name: "session", Value: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal(cookies)
+	} else if c := cookies[0]; !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Fatal(w.Header().Get("Set-Cookie"))
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	if err := SetCookie(w, r, &http.Cookie{Name: "session", Value: "abc", SameSite: http.SameSiteStrictMode}); err != nil {
+		t.Fatal(err)
+	} else if c := w.Result().Cookies()[0]; c.Secure || c.SameSite != http.SameSiteStrictMode {
+		t.Fatal(w.Header().Get("Set-Cookie"))
+	}
+
+	w = httptest.NewRecorder()
+	if err := SetCookie(w, r, &http.Cookie{Name: "session", Value: "abc", SameSite: http.SameSiteNoneMode}); err == nil {
+		t.Fatal("SameSite=None over HTTP")
+	} else if w.Header().Get("Set-Cookie") != "" {
+		t.Fatal(w.Header().Get("Set-Cookie"))
+	}
+
+	if err := SetCookie(w, r, &http.Cookie{Name: "bad name", Value: "abc"}); err == nil {
+		t.Fatal("name")
+	} else if err := SetCookie(w, r, &http.Cookie{Name: "session", Value: "a;b"}); err == nil {
+		t.Fatal("value")
+	}
+}
+
+func TestSetCookieWith(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://example.com/", nil)
+	r.TLS = &tls.ConnectionState{}
+	err := SetCookieWith(w, r, &http.Cookie{Name: "prefs", Value: "dark", SameSite: http.SameSiteNoneMode}, CookieOptions{
+		AllowScript: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if c := w.Result().Cookies()[0]; c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteNoneMode {
+		t.Fatal(w.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestNoListingIndex(t *testing.T) {
+	fsys := http.FS(fstest.MapFS{
+		"index.html":        &fstest.MapFile{Data: []byte("home")},
+		"subdir/hello.html": &fstest.MapFile{Data: []byte("hello")},
+	})
+
+	for _, tt := range []struct {
+		fs   http.FileSystem
+		path string
+		code int
+	}{
+		{NoListingIndex(fsys), "/", http.StatusOK},
+		{NoListingIndex(fsys), "/subdir/", http.StatusNotFound},
+		{NoListingIndex(fsys), "/subdir/hello.html", http.StatusOK},
+		{NoListing(fsys), "/", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.path, nil)
+		http.FileServer(tt.fs).ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.path, w.Code)
+		}
+	}
+}
+
+func TestDefaultErrorTemplate(t *testing.T) {
+	x := SetErrorHandler(HTMLErrorHandler(nil, DefaultErrorTemplate))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, httpsyproblem.StatusNotFound)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html")
+	x.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "<h1>404 Not Found</h1>") {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	x.ServeHTTP(w, r)
+	if w.Header().Get("Content-Type") != "application/problem+json; charset=utf-8" {
+		t.Fatal(w.Header().Get("Content-Type"))
+	}
+}
+
+func TestDrainBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	if !DrainBody(r, 5) {
+		t.Fatal("not drained")
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+	if DrainBody(r, 5) {
+		t.Fatal("drained past limit")
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	if !DrainBody(r, 0) {
+		t.Fatal("no body")
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		accept    string
+		supported []string
+		expected  string
+	}{
+		{"nl-NL,nl;q=0.9,en-US;q=0.8,en;q=0.7", []string{"en", "nl"}, "nl"},
+		{"en-US,en;q=0.5", []string{"de", "en-GB", "en-US"}, "en-US"},
+		{"en-US,en;q=0.5", []string{"de", "en"}, "en"},
+		{"fr;q=0.2, de;q=0.8", []string{"fr", "de"}, "de"},
+		{"fr;q=0, *;q=0.1", []string{"fr", "de"}, "de"},
+		{"fr;q=0", []string{"fr"}, ""},
+		{"", []string{"en"}, ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", tt.accept)
+		if lang := PreferredLanguage(r, tt.supported...); lang != tt.expected {
+			t.Fatal(tt.accept, lang)
+		}
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Vary", "Accept-Encoding")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "nl-NL,en;q=0.5")
+
+	if lang := NegotiateLanguage(w, r, "en", "nl"); lang != "nl" {
+		t.Fatal(lang)
+	}
+	SetContentLanguage(w, "nl")
+
+	if w.Header().Get("Content-Language") != "nl" {
+		t.Fatal(w.Header())
+	} else if vary := w.Header().Values("Vary"); len(vary) != 2 || vary[1] != "Accept-Language" {
+		t.Fatal(vary)
+	}
+}
+
+func TestValueBag(t *testing.T) {
+	type key int
+
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r2 := BagSet(r, key(1), "hello"); r2 != r {
+			t.Fatal("request copied")
+		}
+		if BagGet(r, key(1)) != "hello" || BagGet(r, key(2)) != nil {
+			t.Fatal()
+		}
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if BagGet(r, key(1)) != nil {
+		t.Fatal()
+	}
+	WithValueBag(endpoint).ServeHTTP(httptest.NewRecorder(), r)
+
+	if r = BagSet(r, key(1), "world"); BagGet(r, key(1)) != "world" {
+		t.Fatal()
+	}
+}
+
+func BenchmarkWithContextValue(b *testing.B) {
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r2 := r
+		for k := 0; k < 8; k++ {
+			r2 = WithContextValue(r2, k, k)
+		}
+	}
+}
+
+func BenchmarkValueBag(b *testing.B) {
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r2 := r
+		for k := 0; k < 8; k++ {
+			r2 = BagSet(r2, k, k)
+		}
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/orders/", nil)
+	r.Host = "internal:8080"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "api.example.com, proxy.example.com")
+
+	for _, tt := range []struct {
+		ref        string
+		trustProxy bool
+		expected   string
+	}{
+		{"/users?page=2", true, "https://api.example.com/users?page=2"},
+		{"42", true, "https://api.example.com/orders/42"},
+		{"/users", false, "http://internal:8080/users"},
+	} {
+		if s := AbsoluteURL(r, tt.ref, tt.trustProxy); s != tt.expected {
+			t.Fatal(s)
+		}
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/favicon.ico", nil)
+	Favicon([]byte("icon"), "image/x-icon").ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "icon" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	assertHeaders(t, w.Header(), map[string]string{
+		"Cache-Control":  "public, max-age=604800",
+		"Content-Type":   "image/x-icon",
+		"Content-Length": "4",
+	})
+
+	w = httptest.NewRecorder()
+	Favicon(nil, "").ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatal(w.Code)
+	}
+}
+
+func TestTimeRemaining(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := TimeRemaining(r); ok {
+		t.Fatal("deadline")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	if d, ok := TimeRemaining(r.WithContext(ctx)); !ok || d <= 59*time.Second || d > time.Minute {
+		t.Fatal(d, ok)
+	}
+}
+
+func TestOverlayFS(t *testing.T) {
+	upper := http.FS(fstest.MapFS{
+		"style.css": &fstest.MapFile{Data: []byte("upper")},
+	})
+	lower := http.FS(fstest.MapFS{
+		"style.css": &fstest.MapFile{Data: []byte("lower")},
+		"app.js":    &fstest.MapFile{Data: []byte("app")},
+		"dir/a.txt": &fstest.MapFile{Data: []byte("a")},
+	})
+
+	fsys := NoListing(OverlayFS(upper, lower))
+
+	for _, tt := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/style.css", http.StatusOK, "upper"},
+		{"/app.js", http.StatusOK, "app"},
+		{"/missing.js", http.StatusNotFound, ""},
+		{"/dir/", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.path, nil)
+		http.FileServer(fsys).ServeHTTP(w, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Fatal(tt.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestParseMediaType(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Content-Type", `Multipart/Form-Data; Charset=UTF-8; boundary="----=_Part 1;x"`)
+	mediaType, params, err := ParseMediaType(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if mediaType != "multipart/form-data" || params["charset"] != "UTF-8" || params["boundary"] != "----=_Part 1;x" {
+		t.Fatal(mediaType, params)
+	}
+
+	r.Header.Set("Content-Type", "text/plain; charset")
+	if _, _, err := ParseMediaType(r); StatusCode(err) != http.StatusBadRequest {
+		t.Fatal(err)
+	}
+
+	r.Header.Del("Content-Type")
+	if mediaType, _, err := ParseMediaType(r); mediaType != "" || err != nil {
+		t.Fatal(mediaType, err)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc.def-ghi_jkl~+/==", "abc.def-ghi_jkl~+/==", true},
+		{"bearer  abc ", "abc", true},
+		{"  BEARER abc", "abc", true},
+		{"", "", false},
+		{"Bearer", "", false},
+		{"Bearer ", "", false},
+		{"Basic abc", "", false},
+		{"Bearerabc", "", false},
+		{"Bearer abc def", "", false},
+		{"Bearer =abc", "", false},
+		{"Bearer ab=c", "", false},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", tt.header)
+		if token, ok := BearerToken(r); token != tt.token || ok != tt.ok {
+			t.Fatal(tt.header, token, ok)
+		}
+	}
+}
+
+func TestSafeRedirectTarget(t *testing.T) {
+	for _, tt := range []struct {
+		candidate string
+		ok        bool
+	}{
+		{"/dashboard", true},
+		{"/search?q=a&page=2#results", true},
+		{"settings", true},
+		{"https://example.com/home", true},
+		{"https://EXAMPLE.com/home", true},
+		{"https://auth.example.com/logout", true},
+		{"", false},
+		{"//evil.com", false},
+		{"//evil.com/path", false},
+		{"/\\evil.com", false},
+		{"https://evil.com", false},
+		{"https://example.com@evil.com", false},
+		{"https://example.com:8443/", false},
+		{"javascript:alert(1)", false},
+		{"https:evil.com", false},
+		{"/\tevil", false},
+		{" //evil.com", false},
+		{"\u00a0//evil.com", false},
+		{"/dashboard ", false},
+	} {
+		r := httptest.NewRequest("GET", "https://example.com/login", nil)
+		target, ok := SafeRedirectTarget(r, tt.candidate, "auth.example.com")
+		if ok != tt.ok || (ok && target != tt.candidate) {
+			t.Fatal(tt.candidate, target, ok)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Package httpsytest provides utilities for testing HTTP handlers and middleware.
+package httpsytest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+)
+
+// Recorder is an httptest.ResponseRecorder that also implements
+// io.ReaderFrom, http.Hijacker and http.Pusher, so that the fast paths
+// of middleware that wraps these interfaces can be tested.
+type Recorder struct {
+	*httptest.ResponseRecorder
+
+	// ReadFromCalled reports whether ReadFrom was called.
+	ReadFromCalled bool
+
+	// Pushed lists the targets passed to Push.
+	Pushed []string
+}
+
+// NewRecorder returns an initialized Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (rec *Recorder) ReadFrom(r io.Reader) (int64, error) {
+	rec.ReadFromCalled = true
+	return io.Copy(rec.ResponseRecorder, r)
+}
+
+// Hijack implements http.Hijacker. It always returns http.ErrNotSupported.
+func (rec *Recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrNotSupported
+}
+
+// Push implements http.Pusher by recording the target.
+func (rec *Recorder) Push(target string, opts *http.PushOptions) error {
+	rec.Pushed = append(rec.Pushed, target)
+	return nil
+}
@@ -0,0 +1,35 @@
+package httpsytest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var w http.ResponseWriter = NewRecorder()
+
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	w.(http.Flusher).Flush()
+
+	rec := w.(*Recorder)
+	res := rec.Result()
+	if !rec.ReadFromCalled || !rec.Flushed || rec.Body.String() != "hello" {
+		t.Fatal(rec.Body.String())
+	} else if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/plain" {
+		t.Fatal(res.StatusCode, res.Header)
+	}
+
+	if _, _, err := w.(http.Hijacker).Hijack(); err != http.ErrNotSupported {
+		t.Fatal(err)
+	}
+
+	_ = w.(http.Pusher).Push("/style.css", nil)
+	if len(rec.Pushed) != 1 || rec.Pushed[0] != "/style.css" {
+		t.Fatal(rec.Pushed)
+	}
+}
@@ -4,14 +4,50 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 var (
 	keyErrorHandlerCtxKey = &struct{ byte }{}
 	paramMapCtxKey        = &struct{ byte }{}
+	loggerCtxKey          = &struct{ byte }{}
+	valueBagCtxKey        = &struct{ byte }{}
+	nonceCtxKey           = &struct{ byte }{}
+	bodyBytesCtxKey       = &struct{ byte }{}
+	clientCertCtxKey      = &struct{ byte }{}
+	receivedTimeCtxKey    = &struct{ byte }{}
+	serverTimingCtxKey    = &struct{ byte }{}
+	requestIDCtxKey       = &struct{ byte }{}
+	renderTransformCtxKey = &struct{ byte }{}
 )
 
+// hopByHopHeaders are the headers that apply to a single transport-level connection.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection", // non-standard but still sent by some clients
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// addVary adds name to the Vary header unless it is already listed.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
 func cloneRequestURL(r *http.Request) *http.Request {
 	r2 := new(http.Request)
 	*r2 = *r
@@ -20,6 +56,132 @@ func cloneRequestURL(r *http.Request) *http.Request {
 	return r2
 }
 
+// bodyAllowedForStatus reports whether a given response status code
+// permits a body. See RFC 7230, section 3.3.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func authScheme(challenge string) string {
+	if i := strings.IndexByte(challenge, ' '); i >= 0 {
+		return challenge[:i]
+	}
+	return challenge
+}
+
+// isToken68 reports whether s is valid token68 syntax as defined by RFC 7235 section 2.1.
+func isToken68(s string) bool {
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || c == '+' || c == '/') {
+			break
+		}
+	}
+	if i == 0 {
+		return false
+	}
+	for ; i < len(s); i++ {
+		if s[i] != '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// flusher finds the http.Flusher of w by following the Unwrap chain.
+func flusher(w http.ResponseWriter) (http.Flusher, bool) {
+	for {
+		if f, ok := w.(http.Flusher); ok {
+			return f, true
+		} else if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+			w = u.Unwrap()
+		} else {
+			return nil, false
+		}
+	}
+}
+
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if b := name[i]; b <= ' ' || b >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, b) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func isCookieValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if b := value[i]; b < 0x20 || b >= 0x7f || b == '"' || b == ';' || b == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityValues parses a comma-separated list of values with optional
+// quality weights, such as the Accept-Language header.
+// The values are sorted by descending quality, so values with quality zero
+// (meaning "not acceptable") come last.
+func parseQualityValues(header string) []qualityValue {
+	var values []qualityValue
+	for _, s := range strings.Split(header, ",") {
+		q := 1.0
+		if i := strings.Index(s, ";"); i >= 0 {
+			for _, param := range strings.Split(s[i+1:], ";") {
+				if k, v := cutString(strings.TrimSpace(param), "="); k == "q" {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						q = f
+					}
+				}
+			}
+			s = s[:i]
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, qualityValue{s, q})
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].q > values[j].q
+	})
+	return values
+}
+
+// acceptsHTML reports whether the Accept header lists text/html with a non-zero quality.
+func acceptsHTML(r *http.Request) bool {
+	for _, v := range parseQualityValues(r.Header.Get("Accept")) {
+		if strings.EqualFold(v.value, "text/html") {
+			return v.q > 0
+		}
+	}
+	return false
+}
+
+func cutString(s, sep string) (before, after string) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):]
+	}
+	return s, ""
+}
+
 func stringsMatch(patterns []string, v string) bool {
 	for _, pattern := range patterns {
 		if ok, _ := path.Match(pattern, v); ok {
@@ -51,6 +213,12 @@ func stringsJoinMap(elems []string, sep string, fn func(string) string) string {
 	return b.String()
 }
 
+// requestMediaType returns the media type of the request body, or the empty string if it is malformed.
+func requestMediaType(r *http.Request) string {
+	mediaType, _, _ := ParseMediaType(r)
+	return mediaType
+}
+
 func sameOrigin(url1, url2 *url.URL) bool {
 	return url1 != nil && url2 != nil && url1.Scheme == url2.Scheme && url1.Host == url2.Host
 }
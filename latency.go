@@ -0,0 +1,149 @@
+package httpsy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the histogram buckets used by LatencyStats if none are configured.
+var DefaultLatencyBuckets = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyStats is a middleware that records request durations in fixed-bucket histograms,
+// which provides a latency distribution without depending on a metrics system.
+// The duration is measured from when the middleware is entered until the next handler returns.
+//
+//  stats := &httpsy.LatencyStats{}
+//  h = stats.Handle(h)
+//  ...
+//  p99 := stats.Snapshot()[""].P99
+type LatencyStats struct {
+	// Buckets are the upper bounds of the histogram buckets in ascending order (optional).
+	// Defaults to DefaultLatencyBuckets.
+	Buckets []time.Duration
+
+	// KeyFunc returns the key of the histogram that the request is recorded in (optional).
+	// It is called after the next handler returns, so it can read values that were set by a router,
+	// such as the route pattern. All requests are recorded under the empty key if it is not set.
+	// Keys must have a low cardinality, so do not use the raw URL path.
+	KeyFunc func(*http.Request) string
+
+	mu         sync.Mutex
+	histograms map[string]*latencyHistogram
+}
+
+// LatencySnapshot summarizes the durations recorded in a histogram.
+// Percentiles are estimated by the upper bound of the bucket they fall in,
+// and by the maximum duration if they fall beyond the last bucket.
+type LatencySnapshot struct {
+	Count         int64
+	Mean          time.Duration
+	Max           time.Duration
+	P50, P90, P99 time.Duration
+}
+
+type latencyHistogram struct {
+	counts []int64 // one more than the number of buckets for the overflow
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// Handle returns a middleware handler that records the request durations.
+func (ls *LatencyStats) Handle(next http.Handler) http.Handler {
+	buckets := ls.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	ls.mu.Lock()
+	ls.Buckets = buckets
+	ls.mu.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		defer func() {
+			var key string
+			if ls.KeyFunc != nil {
+				key = ls.KeyFunc(r)
+			}
+			ls.record(key, time.Since(start))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (ls *LatencyStats) record(key string, d time.Duration) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.histograms == nil {
+		ls.histograms = map[string]*latencyHistogram{}
+	}
+
+	h := ls.histograms[key]
+	if h == nil {
+		h = &latencyHistogram{counts: make([]int64, len(ls.Buckets)+1)}
+		ls.histograms[key] = h
+	}
+
+	i := sort.Search(len(ls.Buckets), func(i int) bool { return d <= ls.Buckets[i] })
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Snapshot returns a summary of every histogram by key.
+func (ls *LatencyStats) Snapshot() map[string]LatencySnapshot {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	snapshots := make(map[string]LatencySnapshot, len(ls.histograms))
+	for key, h := range ls.histograms {
+		snapshots[key] = LatencySnapshot{
+			Count: h.count,
+			Mean:  h.sum / time.Duration(h.count),
+			Max:   h.max,
+			P50:   h.percentile(ls.Buckets, 0.50),
+			P90:   h.percentile(ls.Buckets, 0.90),
+			P99:   h.percentile(ls.Buckets, 0.99),
+		}
+	}
+	return snapshots
+}
+
+func (h *latencyHistogram) percentile(buckets []time.Duration, q float64) time.Duration {
+	rank := int64(q*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var n int64
+	for i, count := range h.counts[:len(buckets)] {
+		if n += count; n >= rank {
+			if buckets[i] > h.max {
+				return h.max
+			}
+			return buckets[i]
+		}
+	}
+	return h.max
+}
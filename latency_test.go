@@ -0,0 +1,38 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	stats := &LatencyStats{
+		Buckets: []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond},
+		KeyFunc: func(r *http.Request) string { return r.URL.Path },
+	}
+
+	x := stats.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+
+	for i := 0; i < 100; i++ {
+		target := "/fast"
+		if i == 99 {
+			target = "/fast?slow=1"
+		}
+		x.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	s, ok := stats.Snapshot()["/fast"]
+	if !ok || s.Count != 100 {
+		t.Fatal(s)
+	} else if s.P50 > time.Millisecond {
+		t.Fatal("p50", s.P50)
+	} else if s.Max < 20*time.Millisecond || s.P99 > s.Max {
+		t.Fatal("max", s.Max, "p99", s.P99)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package httpsy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// WithLogger is a middleware that stores the logger in the request context.
+// Handlers retrieve it with Logger.
+func WithLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, WithContextValue(r, loggerCtxKey, logger))
+		})
+	}
+}
+
+// Logger returns the logger that was set with WithLogger.
+// It returns a logger that discards all output if no logger was set.
+//
+//  httpsy.Logger(r).Info("order created", "orderID", orderID)
+func Logger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerCtxKey).(*slog.Logger); ok {
+		return logger
+	}
+	return discardLogger
+}
+
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
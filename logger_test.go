@@ -0,0 +1,32 @@
+//go:build go1.21
+// +build go1.21
+
+package httpsy
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Logger(r).Info("hello", "user", "gopher")
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if Logger(r) == nil {
+		t.Fatal("nil logger")
+	}
+	endpoint.ServeHTTP(httptest.NewRecorder(), r)
+
+	var b bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&b, nil))
+	WithLogger(logger)(endpoint).ServeHTTP(httptest.NewRecorder(), r)
+	if !strings.Contains(b.String(), "msg=hello user=gopher") {
+		t.Fatal(b.String())
+	}
+}
@@ -0,0 +1,85 @@
+package httpsy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// ErrRequestTooLarge is returned by reads from a request body that exceed the limit set by MaxBytes
+// and by ReadAllLimited. It responds with HTTP 413 request entity too large when passed to Error.
+var ErrRequestTooLarge = httpsyproblem.Wrap(http.StatusRequestEntityTooLarge, errors.New("httpsy: request body too large"))
+
+// MaxBytes is a middleware that limits the request body to n bytes using http.MaxBytesReader
+// to protect the server against memory exhaustion. Reads past the limit return ErrRequestTooLarge,
+// which the decoding helpers of this package pass on, so that handlers can reply with Error.
+// A limit of zero means no limit.
+//
+//  if err := httpsy.DecodeJSON(r, &order); err != nil {
+//      httpsy.Error(w, r, err) // 413 if the body is too large, 400 if it is malformed
+//      return
+//  }
+func MaxBytes(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n > 0 && r.Body != nil && r.Body != http.NoBody {
+				r.Body = &maxBytesBody{ReadCloser: http.MaxBytesReader(w, r.Body, n), limit: n}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type maxBytesBody struct {
+	io.ReadCloser
+	limit int64
+	n     int64
+}
+
+// Read translates the error of http.MaxBytesReader into ErrRequestTooLarge.
+// It counts the bytes read instead of inspecting the error,
+// because http.MaxBytesError does not exist before Go 1.19.
+func (b *maxBytesBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF && b.n >= b.limit {
+		err = ErrRequestTooLarge
+	}
+	return n, err
+}
+
+// ReadAllLimited reads the request body up to n bytes.
+// It returns ErrRequestTooLarge if the body is larger than n
+// and an HTTP 400 bad request error if the body cannot be read.
+// A limit of zero means no limit other than the one set by MaxBytes, if any.
+func ReadAllLimited(r *http.Request, n int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	} else if n > 0 && r.ContentLength > n {
+		return nil, ErrRequestTooLarge
+	}
+
+	var body io.Reader = r.Body
+	if n > 0 {
+		body = io.LimitReader(r.Body, n+1)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, bodyReadError(err)
+	} else if n > 0 && int64(len(b)) > n {
+		return nil, ErrRequestTooLarge
+	}
+	return b, nil
+}
+
+// bodyReadError gives an error that occurred while reading the request body a status code:
+// 413 if the body exceeded its limit and 400 otherwise.
+func bodyReadError(err error) error {
+	if errors.Is(err, ErrRequestTooLarge) || isMaxBytesError(err) {
+		return ErrRequestTooLarge
+	}
+	return httpsyproblem.Wrap(http.StatusBadRequest, err)
+}
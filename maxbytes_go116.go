@@ -0,0 +1,10 @@
+//go:build !go1.19
+// +build !go1.19
+
+package httpsy
+
+// isMaxBytesError always reports false because http.MaxBytesError does not exist before Go 1.19.
+// Bodies limited by MaxBytes are still detected by ErrRequestTooLarge.
+func isMaxBytesError(err error) bool {
+	return false
+}
@@ -0,0 +1,15 @@
+//go:build go1.19
+// +build go1.19
+
+package httpsy
+
+import (
+	"errors"
+	"net/http"
+)
+
+// isMaxBytesError reports whether err was returned by a body wrapped with http.MaxBytesReader.
+func isMaxBytesError(err error) bool {
+	var e *http.MaxBytesError
+	return errors.As(err, &e)
+}
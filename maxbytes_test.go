@@ -0,0 +1,55 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBytes(t *testing.T) {
+	x := MaxBytes(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		if err := DecodeJSON(r, &v); err != nil {
+			Error(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`[1,2,3]`, http.StatusNoContent},
+		{`[1,2,3,4,5,6]`, http.StatusRequestEntityTooLarge},
+		{`[1,2`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.body, w.Code)
+		}
+	}
+}
+
+func TestReadAllLimited(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	if b, err := ReadAllLimited(r, 5); err != nil || string(b) != "hello" {
+		t.Fatal(string(b), err)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+	r.ContentLength = -1
+	if _, err := ReadAllLimited(r, 5); err != ErrRequestTooLarge {
+		t.Fatal(err)
+	} else if StatusCode(err) != http.StatusRequestEntityTooLarge {
+		t.Fatal(StatusCode(err))
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+	if b, err := ReadAllLimited(r, 0); err != nil || string(b) != "hello world" {
+		t.Fatal(string(b), err)
+	}
+}
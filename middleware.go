@@ -1,18 +1,28 @@
 package httpsy
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/textproto"
+	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/askeladdk/httpsyproblem"
 )
 
-// AcceptContentTypes only accepts requests that have the Content-Type headers
-// set to one of the given content types.
-// Other requests are responded to with an HTTP 415 unsupported media type.
+// AllowContentType only accepts requests that have the Content-Type header
+// set to one of the given content types. Parameters such as charset are ignored.
+// Requests with a malformed Content-Type header are responded to with an HTTP 400 bad request
+// and other requests with an HTTP 415 unsupported media type.
 func AllowContentType(contentTypes ...string) func(http.Handler) http.Handler {
 	allowedContentTypes := make(map[string]struct{}, len(contentTypes))
 	for _, ctype := range contentTypes {
@@ -27,17 +37,75 @@ func AllowContentType(contentTypes ...string) func(http.Handler) http.Handler {
 				return
 			}
 
-			s := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type")))
-			if i := strings.Index(s, ";"); i > -1 {
-				s = s[0:i]
+			mediaType, _, err := ParseMediaType(r)
+			if err != nil {
+				Error(w, r, err)
+				return
+			} else if _, ok := allowedContentTypes[mediaType]; ok {
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			if _, ok := allowedContentTypes[s]; ok {
+			Error(w, r, httpsyproblem.StatusUnsupportedMediaType)
+		})
+	}
+}
+
+// RejectBodyOn is a middleware that responds with an HTTP 400 bad request to requests
+// that have a body if their method is one of the given methods.
+// A body is present if the Content-Length is greater than zero or if the body is chunked.
+// The body is not read.
+//
+//  RejectBodyOn(http.MethodGet, http.MethodHead, http.MethodDelete)
+func RejectBodyOn(methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength != 0 || len(r.TransferEncoding) > 0 {
+				for _, method := range methods {
+					if r.Method == method {
+						Error(w, r, httpsyproblem.StatusBadRequest)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireHeaders is a middleware that responds with HTTP 400 bad request
+// if the request lacks any of the named headers, such as X-Api-Version or Idempotency-Key.
+// All missing headers are reported at once in the detail and errors of the problem response.
+func RequireHeaders(names ...string) func(http.Handler) http.Handler {
+	canonicalNames := make([]string, len(names))
+	for i, name := range names {
+		canonicalNames[i] = textproto.CanonicalMIMEHeaderKey(name)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var missing []string
+			for _, name := range canonicalNames {
+				if r.Header.Get(name) == "" {
+					missing = append(missing, name)
+				}
+			}
+
+			if len(missing) == 0 {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			Error(w, r, httpsyproblem.StatusUnsupportedMediaType)
+			fields := make([]FieldError, len(missing))
+			for i, name := range missing {
+				fields[i] = FieldError{name, "header is required"}
+			}
+
+			detail := errors.New("missing required headers: " + strings.Join(missing, ", "))
+			Error(w, r, &ValidationError{
+				Details: *httpsyproblem.New(http.StatusBadRequest, detail),
+				Errors:  fields,
+			})
 		})
 	}
 }
@@ -64,11 +132,40 @@ func RealIP(next http.Handler) http.Handler {
 	})
 }
 
+// RequireHost is a middleware that mitigates Host header attacks by only accepting requests
+// for the allowed hosts. Other requests are responded to with an HTTP 421 misdirected request.
+// The request Host is matched against each element using path.Match,
+// ignoring the port and letter case:
+//  RequireHost("example.com", "*.example.com")
+func RequireHost(allowed ...string) func(http.Handler) http.Handler {
+	patterns := make([]string, 0, len(allowed))
+	for _, s := range allowed {
+		patterns = append(patterns, strings.ToLower(s))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+
+			if !stringsMatch(patterns, strings.ToLower(host)) {
+				Error(w, r, Status(http.StatusMisdirectedRequest))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // BasicAuth is a middleware that implements authentication using HTTP Basic Authentication.
 // The authenticate function argument must return nil to indicate that authentication succeeded.
 // Any non-nil error value indicates that authentication failed.
-// The WWW-Authenticate header will be set if the error value has status code 401 Unauthorized
-// using the realm argument. If the realm argument is empty, the realm is set to the hostname.
+// A Basic challenge will be added to the WWW-Authenticate header using Challenge
+// if the error value has status code 401 Unauthorized, so that it can be combined
+// with challenges for other schemes. If the realm argument is empty, the realm is set to the hostname.
 //
 // Note that basic authentication is only secure over HTTPS.
 func BasicAuth(realm string, authenticate func(username, password string) error) func(http.Handler) http.Handler {
@@ -77,13 +174,11 @@ func BasicAuth(realm string, authenticate func(username, password string) error)
 			username, password, _ := r.BasicAuth()
 			if err := authenticate(username, password); err != nil {
 				if httpsyproblem.StatusCode(err) == http.StatusUnauthorized {
-					if w.Header().Get("WWW-Authenticate") == "" {
-						realm := realm
-						if realm == "" {
-							realm = r.Host
-						}
-						w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="utf-8"`, realm))
+					realm := realm
+					if realm == "" {
+						realm = r.Host
 					}
+					Challenge(w, fmt.Sprintf(`Basic realm="%s", charset="utf-8"`, realm))
 				}
 				Error(w, r, err)
 				return
@@ -93,18 +188,154 @@ func BasicAuth(realm string, authenticate func(username, password string) error)
 	}
 }
 
+// Challenge adds a WWW-Authenticate header for each of the challenges, unless
+// a challenge for the same authentication scheme is already present.
+// Multiple challenges tell the client that any of the schemes are accepted
+// when responding with 401 Unauthorized:
+//  httpsy.Challenge(w, `Basic realm="api"`, `Bearer realm="api"`)
+func Challenge(w http.ResponseWriter, challenges ...string) {
+	h := w.Header()
+	for _, challenge := range challenges {
+		scheme := authScheme(challenge)
+		found := false
+		for _, v := range h.Values("WWW-Authenticate") {
+			if strings.EqualFold(authScheme(v), scheme) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			h.Add("WWW-Authenticate", challenge)
+		}
+	}
+}
+
+// BasicAuthMap is a BasicAuth middleware that authenticates against
+// a static map of usernames to hashed passwords.
+// Passwords are verified with the compare function, which must return nil if they match.
+// The function signature is compatible with bcrypt.CompareHashAndPassword:
+//  httpsy.BasicAuthMap("", users, bcrypt.CompareHashAndPassword)
+//
+// Unknown usernames are compared against a dummy hash to not leak their existence through timing.
+func BasicAuthMap(realm string, users map[string]string, compare func(hashedPassword, password []byte) error) func(http.Handler) http.Handler {
+	var dummy []byte
+	for _, hash := range users {
+		dummy = []byte(hash)
+		break
+	}
+
+	return BasicAuth(realm, func(username, password string) error {
+		hash, ok := users[username]
+		if !ok {
+			_ = compare(dummy, []byte(password))
+			return httpsyproblem.StatusUnauthorized
+		} else if compare([]byte(hash), []byte(password)) != nil {
+			return httpsyproblem.StatusUnauthorized
+		}
+		return nil
+	})
+}
+
+// RequireClientCert is a middleware that authenticates clients by their TLS client certificate.
+// Requests without a client certificate are rejected with HTTP 401 unauthorized.
+// Otherwise the leaf certificate is passed to verify and the request is rejected with
+// HTTP 403 forbidden if it returns an error, unless the error carries its own status code.
+// The verified certificate is available to the next handler by ClientCert.
+//
+// The certificate chain must already have been verified by the TLS server,
+// so set tls.Config.ClientAuth to tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert.
+// The verify function only decides whether the identity is authorized:
+//  httpsy.RequireClientCert(func(cert *x509.Certificate) error {
+//      if cert.Subject.CommonName != "billing" {
+//          return errors.New("unknown client")
+//      }
+//      return nil
+//  })
+func RequireClientCert(verify func(*x509.Certificate) error) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+				Error(w, r, httpsyproblem.StatusUnauthorized)
+				return
+			}
+
+			cert := r.TLS.PeerCertificates[0]
+			if err := verify(cert); err != nil {
+				var sc interface{ StatusCode() int }
+				if !errors.As(err, &sc) {
+					err = httpsyproblem.Wrap(http.StatusForbidden, err)
+				}
+				Error(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, WithContextValue(r, clientCertCtxKey, cert))
+		})
+	}
+}
+
+// RedirectSlashes is a middleware that redirects requests for a path with a trailing slash
+// to the same path without it, preserving the query.
+// Safe methods are redirected with 301 moved permanently.
+// Other methods are redirected with 308 permanent redirect,
+// because user agents change the method of a 301 to GET but must repeat it for a 308.
+// The root path is never redirected.
+// See RedirectSlashesCode to use temporary redirects instead.
+func RedirectSlashes(next http.Handler) http.Handler {
+	return RedirectSlashesCode(http.StatusMovedPermanently, http.StatusPermanentRedirect)(next)
+}
+
+// RedirectSlashesCode is like RedirectSlashes but redirects safe methods with the safe status code
+// and other methods with the unsafe status code. Use 302 found and 307 temporary redirect
+// while the URL scheme is still in flux, because permanent redirects are cached by browsers.
+// It panics if either code is not a 3xx status code.
+func RedirectSlashesCode(safe, unsafe int) func(http.Handler) http.Handler {
+	if safe < 300 || safe > 399 || unsafe < 300 || unsafe > 399 {
+		panic("httpsy: RedirectSlashesCode requires 3xx status codes")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Path
+			if len(p) < 2 || p[len(p)-1] != '/' {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// collapse leading slashes so that //host/ cannot redirect to another host
+			target := "/" + strings.Trim(p, "/")
+			if target == p {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			code := unsafe
+			if Safe(r) {
+				code = safe
+			}
+
+			u := url.URL{Path: target, RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, u.String(), code)
+		})
+	}
+}
+
 // RouteParam is a middleware that extracts the head URL parameter
-// from the URL path and stores it as a form value.
+// from the URL path and stores it in the request context.
 //
 //  RouteParam("orderID") // create the middleware
 //  RouteParamValue(r, "orderID") // get the parameter in the handler
 //
+// URL parameters are not form values and cannot be read with r.FormValue.
+// Neither the middleware nor RouteParamValue parse the form,
+// so the request body is left untouched for the handler.
+//
 // The URL parameter may optionally be given a pattern constraint
 // that is matched using path.Match by adding a colon followed by the pattern:
 //  RouteParam("myparam:?*") // matches any sequence of one or more characters
 //
 // It is also possible to use an empty name. In this case the pattern
-// constraint is applied but the value is not stored in the form values:
+// constraint is applied but the value is not stored:
 //  RouteParam(":v[12]") // routes /v1 and /v2 to the same handler
 func RouteParam(param string) func(http.Handler) http.Handler {
 	name, pattern := param, "?*"
@@ -113,6 +344,29 @@ func RouteParam(param string) func(http.Handler) http.Handler {
 		name, pattern = param[:i], param[i+1:]
 	}
 
+	return routeParam(name, func(head string) bool {
+		ok, _ := path.Match(pattern, head)
+		return ok
+	})
+}
+
+// RouteParamOneOf is like RouteParam but constrains the URL parameter
+// to one of the given values instead of a pattern.
+//
+//  RouteParamOneOf("state", "open", "closed", "pending")
+func RouteParamOneOf(name string, values ...string) func(http.Handler) http.Handler {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+
+	return routeParam(name, func(head string) bool {
+		_, ok := set[head]
+		return ok
+	})
+}
+
+func routeParam(name string, match func(string) bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var head string
@@ -120,7 +374,7 @@ func RouteParam(param string) func(http.Handler) http.Handler {
 			if head, r.URL.Path = ShiftPath(r.URL.Path); head == "" {
 				Error(w, r, httpsyproblem.StatusNotFound)
 				return
-			} else if ok, _ := path.Match(pattern, head); !ok {
+			} else if !match(head) {
 				Error(w, r, httpsyproblem.StatusNotFound)
 				return
 			} else if name != "" {
@@ -131,6 +385,254 @@ func RouteParam(param string) func(http.Handler) http.Handler {
 	}
 }
 
+// MethodOverride is a middleware that allows clients which can only send GET and POST
+// requests, such as HTML forms, to invoke other methods.
+// On POST requests the method is taken from the X-HTTP-Method-Override header
+// or from the _method form value and r.Method is rewritten accordingly.
+// Only PUT, PATCH and DELETE are accepted as overrides; all other values are ignored.
+//
+// Place this middleware before any middleware that dispatches on the request method.
+func MethodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			method := r.Header.Get("X-HTTP-Method-Override")
+			if method == "" {
+				method = r.PostFormValue("_method")
+			}
+
+			switch method = strings.ToUpper(method); method {
+			case http.MethodPut, http.MethodPatch, http.MethodDelete:
+				r.Method = method
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DrainBodies is a middleware that calls DrainBody after the next handler returns.
+func DrainBodies(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer DrainBody(r, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BufferBody is a middleware that reads the request body into memory
+// so that it can be read more than once, for example by a middleware that verifies
+// a signature over the body and by the handler that decodes it.
+// Requests whose body exceeds maxBytes are rejected with HTTP 413 request entity too large.
+// Requests without a body are passed on as is.
+// See BodyBytes to access the buffered body and RewindBody to read it again.
+func BufferBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			} else if r.ContentLength > maxBytes {
+				Error(w, r, httpsyproblem.StatusRequestEntityTooLarge)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+			_ = r.Body.Close()
+			if err != nil {
+				Error(w, r, httpsyproblem.Wrap(http.StatusBadRequest, err))
+				return
+			} else if int64(len(body)) > maxBytes {
+				Error(w, r, httpsyproblem.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r = WithContextValue(r, bodyBytesCtxKey, body)
+			r.Body = &bufferedBody{bytes.NewReader(body)}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type bufferedBody struct {
+	*bytes.Reader
+}
+
+func (b *bufferedBody) Close() error {
+	return nil
+}
+
+// ErrResponseTooLarge is returned by writes that exceed the limit set by LimitResponse.
+var ErrResponseTooLarge = errors.New("httpsy: response too large")
+
+// LimitResponse is a middleware that limits the response body to n bytes
+// to guard against runaway responses.
+// Writes past the limit are truncated and return ErrResponseTooLarge.
+// If abort is set, the handler is instead aborted by panicking with http.ErrAbortHandler,
+// which makes the server close the connection so that the client detects the incomplete response.
+// A Content-Length header that exceeds the limit is removed before the header is written
+// and also aborts the handler if abort is set.
+func LimitResponse(n int64, abort bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&limitResponseWriter{ResponseWriter: w, n: n, abort: abort}, r)
+		})
+	}
+}
+
+type limitResponseWriter struct {
+	http.ResponseWriter
+	n           int64
+	abort       bool
+	wroteHeader bool
+}
+
+func (w *limitResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if cl, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil && cl > w.n {
+			if w.abort {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *limitResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if int64(len(p)) <= w.n {
+		n, err := w.ResponseWriter.Write(p)
+		w.n -= int64(n)
+		return n, err
+	} else if w.abort {
+		panic(http.ErrAbortHandler)
+	}
+
+	n, err := w.ResponseWriter.Write(p[:w.n])
+	w.n -= int64(n)
+	if err == nil {
+		err = ErrResponseTooLarge
+	}
+	return n, err
+}
+
+func (w *limitResponseWriter) Flush() {
+	if f, ok := flusher(w.ResponseWriter); ok {
+		f.Flush()
+	}
+}
+
+func (w *limitResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// StripHopByHop is a middleware that removes the hop-by-hop headers from the request
+// as described by RemoveHopByHopHeaders, so that proxy handlers do not forward them.
+// Use RemoveHopByHopHeaders on the response headers received from the upstream server.
+func StripHopByHop(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.Header = r.Header.Clone()
+		RemoveHopByHopHeaders(r2.Header)
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// MarkReceived is a middleware that records the time the request was received.
+// Place it first in the chain so that the time is captured before any queueing middleware.
+// See ReceivedTime and ShedStale.
+func MarkReceived(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ReceivedTime(r); !ok {
+			r = WithContextValue(r, receivedTimeCtxKey, time.Now())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ShedStale is a middleware that sheds load by rejecting requests with
+// HTTP 503 service unavailable if more than maxAge has elapsed since they were received
+// by the time they reach this middleware, for example because they waited in a queue.
+// Such requests have likely been abandoned by the client and are not worth processing.
+// The receive time is recorded by MarkReceived; requests without one are passed on.
+//
+//  h = httpsy.MarkReceived(throttle(httpsy.ShedStale(2 * time.Second)(h)))
+func ShedStale(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if received, ok := ReceivedTime(r); ok && time.Since(received) > maxAge {
+				Error(w, r, httpsyproblem.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DeadlineFromHeader is a middleware that lets clients choose the deadline of their request
+// by sending a duration in the named header, such as X-Request-Timeout: 2s.
+// The duration is parsed by time.ParseDuration and clamped to max.
+// The deadline is max if the header is absent or invalid, so that invalid values are not an error.
+// The deadline is applied to the request context, so the handler must honour the context.
+// If the deadline expires before the handler has written a response,
+// the middleware responds with HTTP 504 gateway timeout after the handler returns.
+func DeadlineFromHeader(header string, max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := max
+			if d, err := time.ParseDuration(r.Header.Get(header)); err == nil && d > 0 && d < max {
+				timeout = d
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tracker, ok := WriteTrackerFrom(w)
+			if !ok {
+				tracker = &WriteTracker{ResponseWriter: w, start: time.Now()}
+				w = tracker
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+
+			if ctx.Err() == context.DeadlineExceeded && !tracker.Written() {
+				Error(w, r, httpsyproblem.StatusGatewayTimeout)
+			}
+		})
+	}
+}
+
+// NormalizeMethod is a middleware that handles requests whose method is one of the
+// standard methods (GET, POST, etc.) in a non-canonical letter case, such as "get".
+// Such methods are uppercased, or responded to with an HTTP 400 bad request if reject is set.
+// Other methods are left alone.
+//
+// Methods are case-sensitive, so rejection is preferred for strict APIs.
+// Normalization is more forgiving towards malformed clients.
+func NormalizeMethod(reject bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch method := strings.ToUpper(r.Method); method {
+			case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+				http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+				if method != r.Method {
+					if reject {
+						Error(w, r, httpsyproblem.StatusBadRequest)
+						return
+					}
+					r.Method = method
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // NoCache is a middleware that sets a number of HTTP headers to prevent
 // a router (or subrouter) from being cached by an upstream proxy and/or client.
 func NoCache(next http.Handler) http.Handler {
@@ -159,24 +661,100 @@ func SetErrorHandler(h ErrorHandlerFunc) func(http.Handler) http.Handler {
 	}
 }
 
+// SetRenderTransform is a middleware that sets a function that Render applies to the data
+// before it is serialised, so that all responses can be wrapped uniformly without changing every handler:
+//  httpsy.SetRenderTransform(func(data interface{}) interface{} {
+//      return map[string]interface{}{"data": data}
+//  })
+// The transform is not applied to responses with an error status code (4xx and 5xx)
+// or to responses written by Error.
+func SetRenderTransform(transform func(data interface{}) interface{}) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, WithContextValue(r, renderTransformCtxKey, transform))
+		})
+	}
+}
+
+// SetErrorMapper is a middleware that translates errors passed to Error before
+// they are handled by the current error handler, so that domain errors
+// can be mapped to HTTP errors in one place instead of in every handler.
+// It must be placed after SetErrorHandler.
+func SetErrorMapper(mapper func(error) error) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := errorHandler(r)
+			mapped := ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+				h(w, r, mapper(err))
+			})
+			next.ServeHTTP(w, WithContextValue(r, keyErrorHandlerCtxKey, mapped))
+		})
+	}
+}
+
+// SetDefaultDetails is a middleware that fills in the Detail member of problems passed to Error
+// with a default message per status code, so that clients receive friendlier errors
+// without every handler spelling them out:
+//  httpsy.SetDefaultDetails(map[int]string{
+//      http.StatusForbidden: "You do not have permission to perform this action.",
+//  })
+// Only bare problems such as httpsyproblem.StatusForbidden are given a default detail.
+// Problems with a detail and other errors, whose message becomes the detail, are left alone.
+// It must be placed after SetErrorHandler.
+func SetDefaultDetails(details map[int]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := errorHandler(r)
+			withDetail := ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+				if d, ok := err.(*httpsyproblem.Details); ok && d.Detail == "" {
+					if detail, ok := details[d.Status]; ok {
+						dd := *d
+						dd.Detail = detail
+						err = &dd
+					}
+				}
+				h(w, r, err)
+			})
+			next.ServeHTTP(w, WithContextValue(r, keyErrorHandlerCtxKey, withDetail))
+		})
+	}
+}
+
 // Recoverer recovers from panics by responding with an HTTP 500 internal server error.
 // The middleware does not recover from http.ErrAbortHandler.
+// See RecovererWith to propagate panics during testing.
 func Recoverer(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if v := recover(); v != nil && v != http.ErrAbortHandler {
-				switch err := v.(type) {
-				case error:
-					Error(w, r, err)
-				case string:
-					Error(w, r, fmt.Errorf(err))
-				default:
-					Error(w, r, fmt.Errorf("%v", err))
+	return RecovererWith(false)(next)
+}
+
+// RecovererWith is like Recoverer, but panics again after recovering if rethrow is set,
+// so that panics surface as test failures with a stack trace instead of as 500 responses.
+// Rethrowing is intended for unit tests and must not be enabled in production.
+//
+//  // in a test
+//  h := httpsy.RecovererWith(true)(newRouter())
+func RecovererWith(rethrow bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if v := recover(); v != nil && v != http.ErrAbortHandler {
+					if rethrow {
+						panic(v)
+					}
+
+					switch err := v.(type) {
+					case error:
+						Error(w, r, err)
+					case string:
+						Error(w, r, fmt.Errorf(err))
+					default:
+						Error(w, r, fmt.Errorf("%v", err))
+					}
 				}
-			}
-		}()
-		next.ServeHTTP(w, r)
-	})
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 // If applies the middlewares only if the condition is true.
@@ -1,14 +1,66 @@
 package httpsy
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/askeladdk/httpsyproblem"
 )
 
+func TestAllowContentType(t *testing.T) {
+	x := AllowContentType("application/json")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		contentType string
+		code        int
+	}{
+		{"application/json", http.StatusNoContent},
+		{"Application/JSON; charset=utf-8", http.StatusNoContent},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/json; charset", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		r.Header.Set("Content-Type", tt.contentType)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.contentType, w.Code)
+		}
+	}
+}
+
+func TestRequireHost(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	x := RequireHost("example.com", "*.example.com")(endpoint)
+
+	for host, code := range map[string]int{
+		"example.com":         http.StatusOK,
+		"API.Example.com:443": http.StatusOK,
+		"evil.com":            http.StatusMisdirectedRequest,
+		"example.com.evil":    http.StatusMisdirectedRequest,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		x.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Fatal(host, w.Code)
+		}
+	}
+}
+
 func TestAuthenticate(t *testing.T) {
 	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username, _, _ := r.BasicAuth()
@@ -57,6 +109,58 @@ func TestAuthenticate(t *testing.T) {
 	})
 }
 
+func TestChallenge(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	authenticate := func(username, password string) error {
+		return httpsyproblem.StatusUnauthorized
+	}
+
+	x := BasicAuth("api", authenticate)(endpoint)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	Challenge(w, `Bearer realm="api"`, `bearer realm="other"`)
+	x.ServeHTTP(w, r)
+
+	challenges := w.Header().Values("WWW-Authenticate")
+	if w.Code != http.StatusUnauthorized || len(challenges) != 2 ||
+		challenges[0] != `Bearer realm="api"` ||
+		challenges[1] != `Basic realm="api", charset="utf-8"` {
+		t.Fatal(challenges)
+	}
+}
+
+func TestBasicAuthMap(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	compare := func(hashedPassword, password []byte) error {
+		if string(hashedPassword) != "hash:"+string(password) {
+			return fmt.Errorf("mismatch")
+		}
+		return nil
+	}
+
+	x := BasicAuthMap("", map[string]string{"gopher": "hash:secret"}, compare)(endpoint)
+
+	for _, tt := range []struct {
+		username, password string
+		code               int
+	}{
+		{"gopher", "secret", http.StatusOK},
+		{"gopher", "helloworld", http.StatusUnauthorized},
+		{"java", "secret", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(tt.username, tt.password)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.username, w.Code)
+		}
+	}
+}
+
 func TestRouteParam(t *testing.T) {
 	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "%s", RouteParamValue(r, "a"))
@@ -83,6 +187,52 @@ func TestRouteParam(t *testing.T) {
 	})
 }
 
+func TestRouteParamOneOf(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", RouteParamValue(r, "state"))
+	})
+
+	x := RouteParamOneOf("state", "open", "closed")(endpoint)
+
+	t.Run("200", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/closed", nil)
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != "closed" {
+			t.Fatal()
+		}
+	})
+
+	t.Run("404", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/pending", nil)
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Fatal()
+		}
+	})
+}
+
+func TestRouteParamNoFormParse(t *testing.T) {
+	x := RouteParam("id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if RouteParamValue(r, "id") != "42" {
+			t.Fatal(RouteParamValue(r, "id"))
+		} else if r.Form != nil || r.PostForm != nil {
+			t.Fatal("form was parsed")
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/42", strings.NewReader("id=13"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	x.ServeHTTP(w, r)
+	if w.Body.String() != "id=13" {
+		t.Fatal(w.Body.String())
+	}
+}
+
 func TestIfEndPoint(t *testing.T) {
 	isPost := func(r *http.Request) bool { return r.Method == "POST" }
 
@@ -146,3 +296,499 @@ func TestRecovererErrAbortHandler(t *testing.T) {
 		Recoverer(endpoint).ServeHTTP(w, r)
 	})
 }
+
+func TestMethodOverride(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", r.Method)
+	})
+
+	x := MethodOverride(endpoint)
+
+	t.Run("form", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", strings.NewReader("_method=DELETE"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		x.ServeHTTP(w, r)
+		if w.Body.String() != http.MethodDelete {
+			t.Fatal(w.Body.String())
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("X-HTTP-Method-Override", "patch")
+		x.ServeHTTP(w, r)
+		if w.Body.String() != http.MethodPatch {
+			t.Fatal(w.Body.String())
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("X-HTTP-Method-Override", "GET")
+		x.ServeHTTP(w, r)
+		if w.Body.String() != http.MethodPost {
+			t.Fatal(w.Body.String())
+		}
+	})
+
+	t.Run("not-post", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/", nil)
+		r.Header.Set("X-HTTP-Method-Override", "DELETE")
+		x.ServeHTTP(w, r)
+		if w.Body.String() != http.MethodPut {
+			t.Fatal(w.Body.String())
+		}
+	})
+}
+
+func TestRecovererWithRethrow(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("gopher!")
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	defer func() {
+		if v := recover(); v != "gopher!" {
+			t.Fatal(v)
+		}
+	}()
+	RecovererWith(true)(endpoint).ServeHTTP(w, r)
+	t.Fatal("not rethrown")
+}
+
+func TestSetErrorMapper(t *testing.T) {
+	errNoRows := fmt.Errorf("no rows")
+
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, fmt.Errorf("query: %w", errNoRows))
+	})
+
+	x := SetErrorMapper(MapErrors(
+		ErrorMapping{errNoRows, httpsyproblem.StatusNotFound},
+	))(endpoint)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	x.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code)
+	}
+}
+
+func TestSetDefaultDetails(t *testing.T) {
+	x := SetDefaultDetails(map[int]string{
+		http.StatusForbidden: "You do not have permission to perform this action.",
+	})
+
+	for _, tt := range []struct {
+		err    error
+		detail string
+	}{
+		{httpsyproblem.StatusForbidden, `"detail":"You do not have permission to perform this action."`},
+		{httpsyproblem.Wrap(http.StatusForbidden, errors.New("read only")), `"detail":"read only"`},
+		{httpsyproblem.StatusNotFound, `"status":404,"title":"Not Found"`},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "application/json")
+		x(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, tt.err)
+		})).ServeHTTP(w, r)
+		if !strings.Contains(w.Body.String(), tt.detail) {
+			t.Fatal(w.Body.String())
+		}
+	}
+
+	if detail := httpsyproblem.StatusForbidden.(*httpsyproblem.Details).Detail; detail != "" {
+		t.Fatal("shared problem was modified:", detail)
+	}
+}
+
+func TestMapErrorsOrder(t *testing.T) {
+	errNotFound := fmt.Errorf("not found")
+	errUserNotFound := fmt.Errorf("user: %w", errNotFound)
+	err := fmt.Errorf("query: %w", errUserNotFound)
+
+	mapper := MapErrors(
+		ErrorMapping{errUserNotFound, httpsyproblem.StatusGone},
+		ErrorMapping{errNotFound, httpsyproblem.StatusNotFound},
+	)
+	for i := 0; i < 10; i++ {
+		if mapped := mapper(err); mapped != httpsyproblem.StatusGone {
+			t.Fatal(mapped)
+		}
+	}
+
+	mapper = MapErrors(
+		ErrorMapping{errNotFound, httpsyproblem.StatusNotFound},
+		ErrorMapping{errUserNotFound, httpsyproblem.StatusGone},
+	)
+	if mapped := mapper(err); mapped != httpsyproblem.StatusNotFound {
+		t.Fatal(mapped)
+	}
+}
+
+func TestLimitResponse(t *testing.T) {
+	var werr error
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+		_, werr = w.Write([]byte(" world"))
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		LimitResponse(8, false)(endpoint).ServeHTTP(w, r)
+		if w.Body.String() != "hello wo" || werr != ErrResponseTooLarge {
+			t.Fatal(w.Body.String(), werr)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler || w.Body.String() != "hello" {
+				t.Fatal(v, w.Body.String())
+			}
+		}()
+		LimitResponse(8, true)(endpoint).ServeHTTP(w, r)
+	})
+
+	t.Run("content-length", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		LimitResponse(8, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "11")
+			_, _ = w.Write([]byte("hello world"))
+		})).ServeHTTP(w, r)
+		if w.Header().Get("Content-Length") != "" || w.Body.String() != "hello wo" {
+			t.Fatal(w.Header().Get("Content-Length"), w.Body.String())
+		}
+	})
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", r.Method)
+	})
+
+	for _, tt := range []struct {
+		method string
+		reject bool
+		code   int
+		body   string
+	}{
+		{"get", false, http.StatusOK, "GET"},
+		{"Delete", false, http.StatusOK, "DELETE"},
+		{"purge", false, http.StatusOK, "purge"},
+		{"get", true, http.StatusBadRequest, ""},
+		{"GET", true, http.StatusOK, "GET"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Method = tt.method
+		NormalizeMethod(tt.reject)(endpoint).ServeHTTP(w, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Fatal(tt.method, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRejectBodyOn(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	x := RejectBodyOn(http.MethodGet, http.MethodDelete)(endpoint)
+
+	for _, tt := range []struct {
+		method, body string
+		chunked      bool
+		code         int
+	}{
+		{"GET", "", false, http.StatusOK},
+		{"GET", "hello", false, http.StatusBadRequest},
+		{"DELETE", "hello", true, http.StatusBadRequest},
+		{"POST", "hello", false, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+		if tt.chunked {
+			r.ContentLength = -1
+			r.TransferEncoding = []string{"chunked"}
+		}
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.method, w.Code)
+		}
+	}
+}
+
+func TestStripHopByHop(t *testing.T) {
+	x := StripHopByHop(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"Connection", "Keep-Alive", "Upgrade", "X-Custom"} {
+			if r.Header.Get(name) != "" {
+				t.Fatal(name)
+			}
+		}
+		if r.Header.Get("X-Forwarded-For") == "" {
+			t.Fatal("end-to-end header removed")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Connection", "keep-alive, X-Custom")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("X-Custom", "hop")
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	x.ServeHTTP(w, r)
+
+	if r.Header.Get("X-Custom") == "" {
+		t.Fatal("original request was modified")
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	// the first consumer reads the body directly
+	consume := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if body, _ := io.ReadAll(r.Body); string(body) != "hello" {
+				t.Fatal(string(body))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	// the second consumer rewinds the body
+	x := BufferBody(8)(consume(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if string(BodyBytes(r)) != "hello" {
+			t.Fatal(string(BodyBytes(r)))
+		} else if body, _ := io.ReadAll(r.Body); len(body) != 0 {
+			t.Fatal("BodyBytes rewound the body")
+		}
+		RewindBody(r)
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})))
+
+	t.Run("200", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != "hello" {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("413", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+		r.ContentLength = -1
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatal(w.Code)
+		}
+	})
+
+	t.Run("NoBody", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		BufferBody(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if BodyBytes(r) != nil {
+				t.Fatal("unexpected body")
+			}
+		})).ServeHTTP(w, r)
+	})
+}
+
+func TestRequireClientCert(t *testing.T) {
+	x := RequireClientCert(func(cert *x509.Certificate) error {
+		if cert.Subject.CommonName != "billing" {
+			return errors.New("unknown client")
+		}
+		return nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ClientCert(r).Subject.CommonName)
+	}))
+
+	for _, tt := range []struct {
+		connState *tls.ConnectionState
+		code      int
+	}{
+		{nil, http.StatusUnauthorized},
+		{&tls.ConnectionState{}, http.StatusUnauthorized},
+		{&tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: "mallory"}},
+		}}, http.StatusForbidden},
+		{&tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: "billing"}},
+		}}, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "https://example.com/", nil)
+		r.TLS = tt.connState
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(w.Code)
+		} else if w.Code == http.StatusOK && w.Body.String() != "billing" {
+			t.Fatal(w.Body.String())
+		}
+	}
+}
+
+func TestRedirectSlashes(t *testing.T) {
+	x := RedirectSlashes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		method   string
+		target   string
+		code     int
+		location string
+	}{
+		{"GET", "/users/?page=2", http.StatusMovedPermanently, "/users?page=2"},
+		{"POST", "/users/", http.StatusPermanentRedirect, "/users"},
+		{"GET", "//evil.com/", http.StatusMovedPermanently, "/evil.com"},
+		{"GET", "/", http.StatusNoContent, ""},
+		{"POST", "/users", http.StatusNoContent, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Fatal(tt.method, tt.target, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRedirectSlashesCode(t *testing.T) {
+	x := RedirectSlashesCode(http.StatusFound, http.StatusTemporaryRedirect)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		method string
+		code   int
+	}{
+		{"GET", http.StatusFound},
+		{"POST", http.StatusTemporaryRedirect},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, "/users/", nil)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Header().Get("Location") != "/users" {
+			t.Fatal(tt.method, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestShedStale(t *testing.T) {
+	delay := func(d time.Duration) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(d)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, tt := range []struct {
+		delay time.Duration
+		code  int
+	}{
+		{0, http.StatusNoContent},
+		{20 * time.Millisecond, http.StatusServiceUnavailable},
+	} {
+		x := MarkReceived(delay(tt.delay)(ShedStale(10 * time.Millisecond)(endpoint)))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatal(tt.delay, w.Code)
+		}
+	}
+}
+
+func TestDeadlineFromHeader(t *testing.T) {
+	x := DeadlineFromHeader("X-Request-Timeout", time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining, ok := TimeRemaining(r)
+		if !ok {
+			t.Fatal("no deadline")
+		}
+		fmt.Fprint(w, remaining.Round(100*time.Millisecond))
+	}))
+
+	for _, tt := range []struct {
+		header   string
+		expected string
+	}{
+		{"200ms", "200ms"},
+		{"1h", "1s"},
+		{"soon", "1s"},
+		{"-1s", "1s"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Request-Timeout", tt.header)
+		x.ServeHTTP(w, r)
+		if w.Body.String() != tt.expected {
+			t.Fatal(tt.header, w.Body.String())
+		}
+	}
+
+	t.Run("504", func(t *testing.T) {
+		x := DeadlineFromHeader("X-Request-Timeout", time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Request-Timeout", "10ms")
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusGatewayTimeout {
+			t.Fatal(w.Code)
+		}
+	})
+}
+
+func TestRequireHeaders(t *testing.T) {
+	x := RequireHeaders("x-api-version", "Idempotency-Key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	t.Run("204", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("X-Api-Version", "2")
+		r.Header.Set("Idempotency-Key", "abc")
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Fatal(w.Code)
+		}
+	})
+
+	t.Run("400", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("X-Api-Version", "2")
+		r.Header.Set("Accept", "application/json")
+		x.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Fatal(w.Code)
+		} else if !strings.Contains(w.Body.String(), `"detail":"missing required headers: Idempotency-Key"`) {
+			t.Fatal(w.Body.String())
+		}
+	})
+}
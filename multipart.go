@@ -0,0 +1,68 @@
+package httpsy
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// MultipartWriter streams a multipart response such as multipart/mixed.
+// Every part is flushed to the client as soon as the next part is created.
+//
+//  mw := httpsy.NewMultipartWriter(w, "multipart/mixed", http.StatusOK)
+//  part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json"}})
+//  _ = json.NewEncoder(part).Encode(metadata)
+//  part, _ = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/png"}})
+//  _, _ = io.Copy(part, file)
+//  _ = mw.Close()
+type MultipartWriter struct {
+	w           http.ResponseWriter
+	mw          *multipart.Writer
+	code        int
+	wroteHeader bool
+}
+
+// NewMultipartWriter returns a MultipartWriter that writes to w.
+// The Content-Type header is set to mediaType with a random boundary parameter.
+// The status code is written when the first part is created.
+func NewMultipartWriter(w http.ResponseWriter, mediaType string, code int) *MultipartWriter {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mediaType+"; boundary="+mw.Boundary())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	return &MultipartWriter{w: w, mw: mw, code: code}
+}
+
+// Boundary returns the boundary that separates the parts.
+func (mw *MultipartWriter) Boundary() string {
+	return mw.mw.Boundary()
+}
+
+// CreatePart flushes the previous part and starts a new part with the given header.
+// The returned writer is valid until the next call to CreatePart or Close.
+func (mw *MultipartWriter) CreatePart(header textproto.MIMEHeader) (io.Writer, error) {
+	mw.writeHeader()
+	mw.flush()
+	return mw.mw.CreatePart(header)
+}
+
+// Close finishes the multipart response and flushes it to the client.
+func (mw *MultipartWriter) Close() error {
+	mw.writeHeader()
+	err := mw.mw.Close()
+	mw.flush()
+	return err
+}
+
+func (mw *MultipartWriter) writeHeader() {
+	if !mw.wroteHeader {
+		mw.wroteHeader = true
+		mw.w.WriteHeader(mw.code)
+	}
+}
+
+func (mw *MultipartWriter) flush() {
+	if f, ok := flusher(mw.w); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,51 @@
+package httpsy
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+)
+
+func TestMultipartWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	mw := NewMultipartWriter(w, "multipart/mixed", http.StatusOK)
+
+	for _, s := range []string{"hello", "world"} {
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(part, s)
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	} else if w.Code != http.StatusOK || !w.Flushed {
+		t.Fatal(w.Code)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" || params["boundary"] != mw.Boundary() {
+		t.Fatal(mediaType, params, err)
+	}
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for _, expected := range []string{"hello", "world"} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(part)
+		if string(b) != expected || part.Header.Get("Content-Type") != "text/plain" {
+			t.Fatal(string(b))
+		}
+	}
+
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatal(err)
+	}
+}
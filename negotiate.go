@@ -0,0 +1,217 @@
+package httpsy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+type rendererRegistry struct {
+	sync.RWMutex
+	mediaTypes []string
+	byType     map[string]Renderer
+}
+
+var renderers = newRendererRegistry()
+
+// newRendererRegistry returns a registry with the default renderers.
+func newRendererRegistry() *rendererRegistry {
+	return &rendererRegistry{
+		mediaTypes: []string{"application/json", "application/xml"},
+		byType: map[string]Renderer{
+			"application/json": JSONRenderer{EscapeHTML: true},
+			"application/xml":  XMLRenderer{},
+		},
+	}
+}
+
+// RegisterRenderer registers the renderer for the media type,
+// replacing the renderer that was registered for it before.
+// Registered renderers are selected by NegotiatingRenderer according to the Accept header.
+// The media types are preferred in order of registration if the client has no preference.
+// JSONRenderer is registered for application/json and XMLRenderer for application/xml by default.
+// It is safe to call RegisterRenderer from init functions and concurrently with rendering.
+//
+//  func init() {
+//      httpsy.RegisterRenderer("application/yaml", YAMLRenderer{})
+//  }
+func RegisterRenderer(mediaType string, rr Renderer) {
+	if rr == nil {
+		panic("httpsy: nil renderer")
+	}
+
+	mediaType = strings.ToLower(mediaType)
+
+	renderers.Lock()
+	defer renderers.Unlock()
+	if _, exists := renderers.byType[mediaType]; !exists {
+		renderers.mediaTypes = append(renderers.mediaTypes, mediaType)
+	}
+	renderers.byType[mediaType] = rr
+}
+
+// LookupRenderer returns the renderer that is registered for the media type.
+func LookupRenderer(mediaType string) (Renderer, bool) {
+	renderers.RLock()
+	defer renderers.RUnlock()
+	rr, ok := renderers.byType[strings.ToLower(mediaType)]
+	return rr, ok
+}
+
+// RegisteredMediaTypes returns the media types of the registered renderers in order of registration.
+func RegisteredMediaTypes() []string {
+	renderers.RLock()
+	defer renderers.RUnlock()
+	return append([]string(nil), renderers.mediaTypes...)
+}
+
+// NegotiateRenderer selects the registered renderer that best matches the Accept header.
+// It returns false if none of the registered media types is acceptable.
+func NegotiateRenderer(r *http.Request) (mediaType string, rr Renderer, ok bool) {
+	renderers.RLock()
+	defer renderers.RUnlock()
+
+	if i := negotiateMediaType(r.Header.Get("Accept"), renderers.mediaTypes); i >= 0 {
+		mediaType = renderers.mediaTypes[i]
+		return mediaType, renderers.byType[mediaType], true
+	}
+	return "", nil, false
+}
+
+// negotiateMediaType returns the index of the offered media type that best matches
+// the Accept header, or -1 if none is acceptable. A missing Accept header accepts anything.
+// As specified by RFC 9110 section 12.5.1, the quality of an offer is taken from the
+// most specific media range that matches it, so that application/json;q=0.1 ranks JSON below
+// other types accepted by */*. Offers are preferred in order if their qualities are equal.
+func negotiateMediaType(accept string, offers []string) int {
+	if accept == "" {
+		accept = "*/*"
+	}
+
+	accepts := parseQualityValues(strings.ToLower(accept))
+
+	best, bestQ := -1, 0.0
+	for i, mediaType := range offers {
+		mediaType = strings.ToLower(mediaType)
+		specificity, q := 0, 0.0
+		for _, accepted := range accepts {
+			if s := mediaRangeSpecificity(accepted.value); s > specificity && mediaRangeMatch(accepted.value, mediaType) {
+				specificity, q = s, accepted.q
+			}
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// mediaRangeSpecificity ranks a media range: 3 for type/subtype, 2 for type/* and 1 for */*.
+func mediaRangeSpecificity(mediaRange string) int {
+	if mediaRange == "*/*" {
+		return 1
+	} else if strings.HasSuffix(mediaRange, "/*") {
+		return 2
+	}
+	return 3
+}
+
+func mediaRangeMatch(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	typ, _ := cutString(mediaType, "/")
+	return strings.HasSuffix(mediaRange, "/*") && mediaRange[:len(mediaRange)-2] == typ
+}
+
+// NegotiatingRenderer is a RequestRenderer that renders data with the registered renderer
+// that best matches the Accept header of the request. The error returned for unacceptable
+// requests responds with HTTP 406 not acceptable.
+// The Content-Type header is set to the negotiated media type if the renderer does not set it,
+// and Accept is added to the Vary header.
+// See RegisterRenderer.
+type NegotiatingRenderer struct{}
+
+// Render implements Renderer by rendering with the renderer that was registered first,
+// because there is no request to negotiate with.
+func (NegotiatingRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
+	renderers.RLock()
+	mediaType := renderers.mediaTypes[0]
+	rr := renderers.byType[mediaType]
+	renderers.RUnlock()
+	return negotiatedRender(rr, mediaType, w, h, d)
+}
+
+// RenderRequest implements RequestRenderer.
+func (NegotiatingRenderer) RenderRequest(w io.Writer, h http.Header, r *http.Request, d interface{}) error {
+	addVary(h, "Accept")
+	mediaType, rr, ok := NegotiateRenderer(r)
+	if !ok {
+		return httpsyproblem.StatusNotAcceptable
+	}
+	return negotiatedRender(rr, mediaType, w, h, d)
+}
+
+func negotiatedRender(rr Renderer, mediaType string, w io.Writer, h http.Header, d interface{}) error {
+	if err := rr.Render(w, h, d); err != nil {
+		return err
+	} else if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", mediaType)
+	}
+	return nil
+}
+
+// Offer pairs a media type with the renderer that produces it for RenderNegotiated.
+type Offer struct {
+	MediaType string
+	Renderer  Renderer
+}
+
+// RenderNegotiated renders the data with the offered renderer that best matches the Accept header
+// of the request, supporting quality values and the */* and type/* wildcards.
+// Offers are preferred in order if the client has no preference.
+// The registered renderers are offered if there are no offers. See RegisterRenderer.
+// It replies with HTTP 406 not acceptable if none of the offers is acceptable.
+//
+//  httpsy.RenderNegotiated(w, r, http.StatusOK, data,
+//      httpsy.Offer{MediaType: "application/json", Renderer: httpsy.JSONRenderer{}},
+//      httpsy.Offer{MediaType: "application/xml", Renderer: httpsy.XMLRenderer{}},
+//  )
+func RenderNegotiated(w http.ResponseWriter, r *http.Request, code int, data interface{}, offers ...Offer) {
+	if len(offers) == 0 {
+		Render(NegotiatingRenderer{}, w, r, code, data)
+		return
+	}
+
+	addVary(w.Header(), "Accept")
+
+	mediaTypes := make([]string, len(offers))
+	for i, offer := range offers {
+		mediaTypes[i] = offer.MediaType
+	}
+
+	i := negotiateMediaType(r.Header.Get("Accept"), mediaTypes)
+	if i < 0 {
+		Error(w, r, httpsyproblem.StatusNotAcceptable)
+		return
+	}
+
+	Render(negotiatedRenderer{offers[i]}, w, r, code, data)
+}
+
+type negotiatedRenderer struct {
+	Offer
+}
+
+func (rr negotiatedRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
+	return negotiatedRender(rr.Renderer, rr.MediaType, w, h, d)
+}
+
+// Negotiate is a convenience function that wraps NegotiatingRenderer
+// to reply in the media type that the client prefers.
+func Negotiate(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	Render(NegotiatingRenderer{}, w, r, code, data)
+}
@@ -0,0 +1,110 @@
+package httpsy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testRenderer struct{}
+
+func (testRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
+	_, err := fmt.Fprintf(w, "test:%v", d)
+	return err
+}
+
+// resetRenderers restores the default renderers after a test has registered its own.
+func resetRenderers() {
+	defaults := newRendererRegistry()
+	renderers.Lock()
+	defer renderers.Unlock()
+	renderers.mediaTypes, renderers.byType = defaults.mediaTypes, defaults.byType
+}
+
+func TestNegotiatingRenderer(t *testing.T) {
+	RegisterRenderer("application/x-test", testRenderer{})
+	defer resetRenderers()
+
+	if _, ok := LookupRenderer("application/x-test"); !ok {
+		t.Fatal("not registered")
+	}
+
+	for _, tt := range []struct {
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"", http.StatusOK, "application/json; charset=utf-8", "\"hello\"\n"},
+		{"application/x-test", http.StatusOK, "application/x-test", "test:hello"},
+		{"text/html, application/*;q=0.9", http.StatusOK, "application/json; charset=utf-8", "\"hello\"\n"},
+		{"application/*, application/json;q=0", http.StatusOK, "application/xml; charset=utf-8", "<string>hello</string>"},
+		{"application/x-test;q=0.5, application/xml;q=0.9", http.StatusOK, "application/xml; charset=utf-8", "<string>hello</string>"},
+		{"application/json;q=0.1, */*", http.StatusOK, "application/xml; charset=utf-8", "<string>hello</string>"},
+		{"application/*;q=0, */*", http.StatusNotAcceptable, "", ""},
+		{"text/html", http.StatusNotAcceptable, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		Negotiate(w, r, http.StatusOK, "hello")
+
+		if w.Code != tt.code {
+			t.Fatal(tt.accept, w.Code)
+		} else if w.Code != http.StatusOK {
+			continue
+		} else if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Fatal(tt.accept, ct)
+		} else if w.Body.String() != tt.body {
+			t.Fatal(tt.accept, w.Body.String())
+		} else if w.Header().Get("Vary") != "Accept" {
+			t.Fatal(w.Header())
+		}
+	}
+}
+
+func TestResetRenderers(t *testing.T) {
+	RegisterRenderer("application/x-test", testRenderer{})
+	resetRenderers()
+
+	if _, ok := LookupRenderer("application/x-test"); ok {
+		t.Fatal("not reset")
+	} else if mediaTypes := RegisteredMediaTypes(); len(mediaTypes) != 2 {
+		t.Fatal(mediaTypes)
+	}
+}
+
+func TestRenderNegotiated(t *testing.T) {
+	offers := []Offer{
+		{"application/json", JSONRenderer{}},
+		{"text/plain", testRenderer{}},
+	}
+
+	for _, tt := range []struct {
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"", http.StatusOK, "application/json; charset=utf-8"},
+		{"*/*", http.StatusOK, "application/json; charset=utf-8"},
+		{"text/*", http.StatusOK, "text/plain"},
+		{"application/json;q=0.1, text/plain;q=0.2", http.StatusOK, "text/plain"},
+		{"application/json;q=0.1, */*", http.StatusOK, "text/plain"},
+		{"application/*;q=0, */*", http.StatusOK, "text/plain"},
+		{"text/*;q=0.5, text/plain;q=0.1, application/*;q=0.2", http.StatusOK, "application/json; charset=utf-8"},
+		{"application/xml", http.StatusNotAcceptable, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		RenderNegotiated(w, r, http.StatusOK, "hello", offers...)
+
+		if w.Code != tt.code {
+			t.Fatal(tt.accept, w.Code)
+		} else if w.Code == http.StatusOK && w.Header().Get("Content-Type") != tt.contentType {
+			t.Fatal(tt.accept, w.Header().Get("Content-Type"))
+		}
+	}
+}
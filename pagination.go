@@ -0,0 +1,130 @@
+package httpsy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// PageDefaults configures how Pagination parses the limit and offset query parameters.
+type PageDefaults struct {
+	// Limit is the limit used when the request does not specify one.
+	// It defaults to 20, or to MaxLimit if that is smaller.
+	Limit int `json:"limit" yaml:"limit"`
+
+	// MinLimit is the smallest limit that a request may specify. It defaults to 1.
+	MinLimit int `json:"minLimit,omitempty" yaml:"minLimit,omitempty"`
+
+	// MaxLimit is the largest limit that a request may specify.
+	// Zero means that the limit is unbounded.
+	MaxLimit int `json:"maxLimit,omitempty" yaml:"maxLimit,omitempty"`
+}
+
+// Pagination parses and validates the limit and offset query parameters.
+// Parameters that are absent take on the default limit and an offset of zero.
+// It returns an HTTP 400 bad request problem if a parameter is not an integer,
+// if the requested limit is out of bounds or if the offset is negative.
+// The bounds only apply to the limit requested by the client, not to the default limit.
+//
+//  limit, offset, err := httpsy.Pagination(r, httpsy.PageDefaults{Limit: 20, MaxLimit: 100})
+//  if err != nil {
+//      httpsy.Error(w, r, err)
+//      return
+//  }
+func Pagination(r *http.Request, defaults PageDefaults) (limit, offset int, err error) {
+	minLimit := defaults.MinLimit
+	if minLimit <= 0 {
+		minLimit = 1
+	}
+
+	query := r.URL.Query()
+
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil {
+			return 0, 0, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("invalid limit %q", s))
+		} else if limit < minLimit || (defaults.MaxLimit > 0 && limit > defaults.MaxLimit) {
+			return 0, 0, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("limit %d out of range", limit))
+		}
+	} else if limit = defaults.Limit; limit <= 0 {
+		limit = 20
+		if defaults.MaxLimit > 0 && limit > defaults.MaxLimit {
+			limit = defaults.MaxLimit
+		}
+	}
+
+	if s := query.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("invalid offset %q", s))
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// EncodeCursor encodes v as an opaque cursor for cursor-based pagination.
+// The cursor is URL-safe base64 encoded JSON, so it is not tamper-proof
+// and must be validated after it is decoded.
+func EncodeCursor(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor decodes a cursor created by EncodeCursor into v.
+// It returns an HTTP 400 bad request problem if the cursor is malformed.
+//
+//  var cursor struct{ After int64 }
+//  if s := r.URL.Query().Get("cursor"); s != "" {
+//      if err := httpsy.DecodeCursor(s, &cursor); err != nil {
+//          httpsy.Error(w, r, err)
+//          return
+//      }
+//  }
+func DecodeCursor(cursor string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return httpsyproblem.Wrap(http.StatusBadRequest, errors.New("invalid cursor"))
+	} else if err := json.Unmarshal(b, v); err != nil {
+		return httpsyproblem.Wrap(http.StatusBadRequest, errors.New("invalid cursor"))
+	}
+	return nil
+}
+
+var linkURLReplacer = strings.NewReplacer("<", "%3C", ">", "%3E", " ", "%20", `"`, "%22")
+
+// SetLinkHeader adds RFC 8288 links to the Link header, which maps relation types to URLs.
+// The links are sorted by relation type and appended to any existing Link header as a comma-separated list.
+// Characters that would break the header syntax are percent-encoded.
+//
+//  httpsy.SetLinkHeader(w, map[string]string{
+//      "next": "/orders?offset=40&limit=20",
+//      "prev": "/orders?offset=0&limit=20",
+//  })
+func SetLinkHeader(w http.ResponseWriter, links map[string]string) {
+	rels := make([]string, 0, len(links))
+	for rel := range links {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	values := make([]string, 0, len(links)+1)
+	if v := w.Header().Get("Link"); v != "" {
+		values = append(values, v)
+	}
+	for _, rel := range rels {
+		values = append(values, "<"+linkURLReplacer.Replace(links[rel])+`>; rel="`+rel+`"`)
+	}
+
+	if len(values) != 0 {
+		w.Header().Set("Link", strings.Join(values, ", "))
+	}
+}
@@ -0,0 +1,89 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+func TestPagination(t *testing.T) {
+	defaults := PageDefaults{Limit: 20, MaxLimit: 100}
+
+	for _, tt := range []struct {
+		query  string
+		limit  int
+		offset int
+		code   int
+	}{
+		{"", 20, 0, 0},
+		{"?limit=50&offset=10", 50, 10, 0},
+		{"?limit=101", 0, 0, http.StatusBadRequest},
+		{"?limit=0", 0, 0, http.StatusBadRequest},
+		{"?limit=ten", 0, 0, http.StatusBadRequest},
+		{"?offset=-1", 0, 0, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("GET", "/"+tt.query, nil)
+		limit, offset, err := Pagination(r, defaults)
+		if tt.code != 0 {
+			if httpsyproblem.StatusCode(err) != tt.code {
+				t.Fatal(tt.query, err)
+			}
+		} else if err != nil || limit != tt.limit || offset != tt.offset {
+			t.Fatal(tt.query, limit, offset, err)
+		}
+	}
+}
+
+func TestPaginationZeroDefaults(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if limit, offset, err := Pagination(r, PageDefaults{}); err != nil || limit != 20 || offset != 0 {
+		t.Fatal(limit, offset, err)
+	}
+
+	if limit, _, err := Pagination(r, PageDefaults{MaxLimit: 10}); err != nil || limit != 10 {
+		t.Fatal(limit, err)
+	}
+
+	r = httptest.NewRequest("GET", "/?limit=0", nil)
+	if _, _, err := Pagination(r, PageDefaults{}); httpsyproblem.StatusCode(err) != http.StatusBadRequest {
+		t.Fatal(err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	type cursor struct{ After int }
+
+	s, err := EncodeCursor(cursor{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c cursor
+	if err := DecodeCursor(s, &c); err != nil || c.After != 42 {
+		t.Fatal(c, err)
+	}
+
+	if err := DecodeCursor("!!", &c); httpsyproblem.StatusCode(err) != http.StatusBadRequest {
+		t.Fatal(err)
+	}
+}
+
+func TestSetLinkHeader(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Link", `</style.css>; rel="preload"`)
+	SetLinkHeader(w, map[string]string{
+		"prev": "/orders?offset=0&limit=20",
+		"next": "/orders?offset=40&limit=20",
+		"last": "/orders?q=<a b>",
+	})
+
+	expected := `</style.css>; rel="preload", ` +
+		`</orders?q=%3Ca%20b%3E>; rel="last", ` +
+		`</orders?offset=40&limit=20>; rel="next", ` +
+		`</orders?offset=0&limit=20>; rel="prev"`
+	if link := w.Header().Get("Link"); link != expected {
+		t.Fatal(link)
+	}
+}
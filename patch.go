@@ -0,0 +1,302 @@
+package httpsy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch document to the original JSON document
+// and returns the patched document.
+// It returns an HTTP 400 bad request problem if the patch is not valid JSON.
+func ApplyMergePatch(original, patch []byte) ([]byte, error) {
+	doc, err := decodeJSON(original)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return nil, httpsyproblem.Wrap(http.StatusBadRequest, err)
+	}
+
+	return json.Marshal(mergePatch(doc, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch document to the original JSON document
+// and returns the patched document.
+// It returns an HTTP 400 bad request problem if the patch is malformed
+// and an HTTP 422 unprocessable entity problem if an operation cannot be applied,
+// including when a test operation fails.
+// The original document is never partially patched.
+func ApplyJSONPatch(original, patch []byte) ([]byte, error) {
+	doc, err := decodeJSON(original)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  *string         `json:"path"`
+		From  *string         `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, httpsyproblem.Wrap(http.StatusBadRequest, err)
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: missing path", i))
+		}
+
+		path, err := parseJSONPointer(*op.Path)
+		if err != nil {
+			return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: %w", i, err))
+		}
+
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: missing value", i))
+			} else if value, err = decodeJSON(op.Value); err != nil {
+				return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: %w", i, err))
+			}
+		}
+
+		var from []string
+		switch op.Op {
+		case "move", "copy":
+			if op.From == nil {
+				return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: missing from", i))
+			} else if from, err = parseJSONPointer(*op.From); err != nil {
+				return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: %w", i, err))
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = jsonPatchAdd(doc, path, value)
+		case "remove":
+			doc, _, err = jsonPatchRemove(doc, path)
+		case "replace":
+			if len(path) == 0 {
+				doc = value
+			} else if doc, _, err = jsonPatchRemove(doc, path); err == nil {
+				doc, err = jsonPatchAdd(doc, path, value)
+			}
+		case "move":
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				err = errors.New("cannot move a value into one of its children")
+			} else if doc, value, err = jsonPatchRemove(doc, from); err == nil {
+				doc, err = jsonPatchAdd(doc, path, value)
+			}
+		case "copy":
+			if value, err = jsonPatchGet(doc, from); err == nil {
+				if value, err = deepCopyJSON(value); err == nil {
+					doc, err = jsonPatchAdd(doc, path, value)
+				}
+			}
+		case "test":
+			var actual interface{}
+			if actual, err = jsonPatchGet(doc, path); err == nil && !equalJSON(actual, value) {
+				err = errors.New("test failed")
+			}
+		default:
+			return nil, httpsyproblem.Wrap(http.StatusBadRequest, fmt.Errorf("operation %d: invalid op %q", i, op.Op))
+		}
+
+		if err != nil {
+			return nil, httpsyproblem.Wrap(http.StatusUnprocessableEntity, fmt.Errorf("operation %d: %s %s: %w", i, op.Op, *op.Path, err))
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	} else if d.More() {
+		return nil, errors.New("invalid JSON: trailing data")
+	}
+	return v, nil
+}
+
+func deepCopyJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
+
+func equalJSON(a, b interface{}) bool {
+	normalise := func(v interface{}) (interface{}, bool) {
+		var w interface{}
+		data, err := json.Marshal(v)
+		return w, err == nil && json.Unmarshal(data, &w) == nil
+	}
+	a, ok1 := normalise(a)
+	b, ok2 := normalise(b)
+	return ok1 && ok2 && reflect.DeepEqual(a, b)
+}
+
+func parseJSONPointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	} else if s[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func jsonArrayIndex(token string, n int, end bool) (int, error) {
+	if end && token == "-" {
+		return n, nil
+	} else if len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	} else if i, err := strconv.Atoi(token); err != nil || i < 0 || i > n || (i == n && !end) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	} else {
+		return i, nil
+	}
+}
+
+func jsonPatchGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot index %q into a scalar", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonPatchUpdate replaces the child of doc at path by the result of fn.
+// It returns the updated doc, which may be a different value if doc is an array.
+func jsonPatchUpdate(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := jsonPatchGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	} else if child, err = jsonPatchUpdate(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		i, _ := jsonArrayIndex(path[0], len(node), false)
+		node[i] = child
+	}
+	return doc, nil
+}
+
+func jsonPatchAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return jsonPatchUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar", token)
+		}
+	})
+}
+
+func jsonPatchRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the root")
+	}
+
+	var removed interface{}
+	doc, err := jsonPatchUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			removed = v
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a scalar", token)
+		}
+	})
+	return doc, removed, err
+}
@@ -0,0 +1,59 @@
+package httpsy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	original := `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`
+	patch := `{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`
+	expected := `{"author":{"givenName":"John"},"content":"This will be unchanged","phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`
+
+	if b, err := ApplyMergePatch([]byte(original), []byte(patch)); err != nil {
+		t.Fatal(err)
+	} else if string(b) != expected {
+		t.Fatal(string(b))
+	}
+
+	if _, err := ApplyMergePatch([]byte(original), []byte(`{`)); httpsyproblem.StatusCode(err) != http.StatusBadRequest {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	for _, tt := range []struct {
+		original, patch, expected string
+		code                      int
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, 0},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, 0},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`, 0},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, 0},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, 0},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, 0},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, 0},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, 0},
+		{`{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, `{"baz":{"bar":2},"foo":{"bar":1}}`, 0},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1.0},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`, 0},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, http.StatusUnprocessableEntity},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, http.StatusUnprocessableEntity},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/01","value":"qux"}]`, ``, http.StatusUnprocessableEntity},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, ``, http.StatusBadRequest},
+		{`{"foo":"bar"}`, `[{"op":"frobnicate","path":"/baz"}]`, ``, http.StatusBadRequest},
+		{`{"foo":"bar"}`, `{}`, ``, http.StatusBadRequest},
+	} {
+		b, err := ApplyJSONPatch([]byte(tt.original), []byte(tt.patch))
+		if tt.code != 0 {
+			if httpsyproblem.StatusCode(err) != tt.code {
+				t.Fatal(tt.patch, err)
+			}
+		} else if err != nil {
+			t.Fatal(tt.patch, err)
+		} else if string(b) != tt.expected {
+			t.Fatal(tt.patch, string(b))
+		}
+	}
+}
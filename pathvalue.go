@@ -0,0 +1,27 @@
+//go:build go1.22
+// +build go1.22
+
+package httpsy
+
+import (
+	"net/http"
+)
+
+// PathValues is a middleware that copies the named wildcards that were matched by
+// a Go 1.22 http.ServeMux pattern into the route parameters,
+// so that handlers can read them with RouteParamValue regardless of how the request was routed.
+// Wildcards that did not match are not copied.
+//
+//  mux.Handle("GET /orders/{orderID}", httpsy.PathValues("orderID")(h))
+func PathValues(names ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, name := range names {
+				if v := r.PathValue(name); v != "" {
+					r = setParamValue(r, name, v)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
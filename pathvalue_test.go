@@ -0,0 +1,27 @@
+//go:build go1.22
+// +build go1.22
+
+package httpsy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathValues(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s/%s", RouteParamValue(r, "a"), RouteParamValue(r, "b"))
+	})
+
+	x := PathValues("a", "b")(endpoint)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetPathValue("a", "hello")
+	x.ServeHTTP(w, r)
+	if w.Body.String() != "hello/" {
+		t.Fatal(w.Body.String())
+	}
+}
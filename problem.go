@@ -0,0 +1,41 @@
+package httpsy
+
+import (
+	"net/http"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// FieldError describes why the value of a single input field is invalid.
+type FieldError struct {
+	// Field is the name of the invalid field.
+	Field string `json:"field" xml:"field"`
+
+	// Message is a human-readable explanation of why the field is invalid.
+	Message string `json:"message" xml:"message"`
+}
+
+// ValidationError is a problem that lists the fields that failed validation.
+// It embeds httpsyproblem.Details, so httpsyproblem.Serve marshals it
+// to JSON or XML depending on the Accept header like any other problem.
+type ValidationError struct {
+	httpsyproblem.Details
+	Errors []FieldError `json:"errors" xml:"errors>error"`
+}
+
+// UnprocessableEntity returns a ValidationError that responds with HTTP 422 unprocessable entity
+// and reports the invalid fields.
+//
+//  if name == "" {
+//      httpsy.Error(w, r, httpsy.UnprocessableEntity(httpsy.FieldError{"name", "must not be empty"}))
+//      return
+//  }
+func UnprocessableEntity(fields ...FieldError) error {
+	if fields == nil {
+		fields = []FieldError{}
+	}
+	return &ValidationError{
+		Details: *httpsyproblem.New(http.StatusUnprocessableEntity, nil),
+		Errors:  fields,
+	}
+}
@@ -0,0 +1,42 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnprocessableEntity(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	Error(w, r, UnprocessableEntity(FieldError{"name", "must not be empty"}))
+
+	expected := `{"status":422,"title":"Unprocessable Entity","type":"about:blank","errors":[{"field":"name","message":"must not be empty"}]}` + "\n"
+	if w.Code != http.StatusUnprocessableEntity || w.Body.String() != expected {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	if w.Header().Get("Content-Type") != "application/problem+json; charset=utf-8" {
+		t.Fatal(w.Header().Get("Content-Type"))
+	}
+}
+
+func TestUnprocessableEntityXML(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept", "application/xml")
+	Error(w, r, UnprocessableEntity(FieldError{"name", "must not be empty"}))
+
+	expected := `<errors><error><field>name</field><message>must not be empty</message></error></errors>`
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), expected) {
+		t.Fatal(w.Code, w.Body.String())
+	} else if !strings.Contains(w.Body.String(), `<problem xmlns="urn:ietf:rfc:7807">`) {
+		t.Fatal(w.Body.String())
+	}
+
+	if w.Header().Get("Content-Type") != "application/problem+xml; charset=utf-8" {
+		t.Fatal(w.Header().Get("Content-Type"))
+	}
+}
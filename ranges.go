@@ -0,0 +1,91 @@
+package httpsy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// ServeRangeReader replies to the request with the size bytes that are read from ra,
+// honouring a single byte range in the Range header with 206 partial content.
+// Unsatisfiable ranges are answered with HTTP 416 requested range not satisfiable through Error.
+// Malformed and multiple ranges are ignored and the full content is served instead, as RFC 7233 permits.
+// If the response has an ETag header, an If-Range header that does not match it also causes
+// the full content to be served.
+//
+// Unlike http.ServeContent it does not require an io.ReadSeeker,
+// so it is suitable for content that is generated on demand, such as exports.
+// The caller is responsible for setting the Content-Type header.
+func ServeRangeReader(w http.ResponseWriter, r *http.Request, size int64, ra io.ReaderAt) {
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+
+	code := http.StatusOK
+	start, length := int64(0), size
+
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		if ifRange := r.Header.Get("If-Range"); ifRange == "" || ifRange == h.Get("Etag") {
+			if s, n, ok, satisfiable := parseByteRange(rangeHeader, size); !satisfiable {
+				h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+				Error(w, r, httpsyproblem.StatusRequestedRangeNotSatisfiable)
+				return
+			} else if ok {
+				code, start, length = http.StatusPartialContent, s, n
+				h.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+
+					strconv.FormatInt(start+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+			}
+		}
+	}
+
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, io.NewSectionReader(ra, start, length))
+	}
+}
+
+// parseByteRange parses a Range header that holds a single byte range.
+// ok is false if the header should be ignored because it is malformed or holds multiple ranges.
+// satisfiable is false if the range lies entirely beyond the content.
+func parseByteRange(s string, size int64) (start, length int64, ok, satisfiable bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) || strings.Contains(s, ",") {
+		return 0, 0, false, true
+	}
+
+	first, last := cutString(strings.TrimSpace(s[len(prefix):]), "-")
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+	if first == "" {
+		// suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, true
+		} else if n == 0 || size == 0 {
+			return 0, 0, false, false
+		} else if n > size {
+			n = size
+		}
+		return size - n, n, true, true
+	}
+
+	i, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || i < 0 {
+		return 0, 0, false, true
+	} else if i >= size {
+		return 0, 0, false, false
+	}
+
+	j := size - 1
+	if last != "" {
+		if j, err = strconv.ParseInt(last, 10, 64); err != nil || j < i {
+			return 0, 0, false, true
+		} else if j >= size {
+			j = size - 1
+		}
+	}
+	return i, j - i + 1, true, true
+}
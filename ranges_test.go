@@ -0,0 +1,48 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeRangeReader(t *testing.T) {
+	content := "0123456789"
+
+	for _, tt := range []struct {
+		byteRange    string
+		ifRange      string
+		code         int
+		contentRange string
+		body         string
+	}{
+		{"", "", http.StatusOK, "", content},
+		{"bytes=2-5", "", http.StatusPartialContent, "bytes 2-5/10", "2345"},
+		{"bytes=7-", "", http.StatusPartialContent, "bytes 7-9/10", "789"},
+		{"bytes=-3", "", http.StatusPartialContent, "bytes 7-9/10", "789"},
+		{"bytes=8-20", "", http.StatusPartialContent, "bytes 8-9/10", "89"},
+		{"bytes=10-", "", http.StatusRequestedRangeNotSatisfiable, "bytes */10", ""},
+		{"bytes=0-1,4-5", "", http.StatusOK, "", content},
+		{"lines=1-2", "", http.StatusOK, "", content},
+		{"bytes=2-5", `"v2"`, http.StatusOK, "", content},
+		{"bytes=2-5", `"v1"`, http.StatusPartialContent, "bytes 2-5/10", "2345"},
+	} {
+		w := httptest.NewRecorder()
+		w.Header().Set("ETag", `"v1"`)
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.byteRange != "" {
+			r.Header.Set("Range", tt.byteRange)
+		}
+		if tt.ifRange != "" {
+			r.Header.Set("If-Range", tt.ifRange)
+		}
+
+		ServeRangeReader(w, r, int64(len(content)), strings.NewReader(content))
+		if w.Code != tt.code || w.Header().Get("Content-Range") != tt.contentRange {
+			t.Fatal(tt.byteRange, w.Code, w.Header().Get("Content-Range"))
+		} else if w.Code != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != tt.body {
+			t.Fatal(tt.byteRange, w.Body.String())
+		}
+	}
+}
@@ -3,10 +3,15 @@ package httpsy
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"html/template"
 	"io"
+	"io/fs"
 	"net/http"
+	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 // Renderer serialises a value to a writer.
@@ -14,17 +19,103 @@ type Renderer interface {
 	Render(io.Writer, http.Header, interface{}) error
 }
 
+// XMLRenderer serialises data to an XML document.
+// The X-Content-Type-Options: nosniff header is set unless DisableNosniff is set.
+// Charset is described by JSONRenderer.
+type XMLRenderer struct {
+	Prefix, Indent string
+	Charset        string
+	DisableNosniff bool
+}
+
+// Render implements Renderer.
+func (r XMLRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/xml; charset="+charsetOrUTF8(r.Charset))
+		if !r.DisableNosniff {
+			h.Set("X-Content-Type-Options", "nosniff")
+		}
+	}
+	e := xml.NewEncoder(charsetWriter(w, r.Charset))
+	e.Indent(r.Prefix, r.Indent)
+	return e.Encode(d)
+}
+
+// ErrCharset is returned by renderers that cannot represent their output in the configured charset.
+var ErrCharset = errors.New("httpsy: output not representable in charset")
+
+func charsetOrUTF8(charset string) string {
+	if charset == "" {
+		return "utf-8"
+	}
+	return charset
+}
+
+// charsetWriter returns a writer that rejects non-ASCII output
+// unless charset is utf-8, because the output is not transcoded.
+func charsetWriter(w io.Writer, charset string) io.Writer {
+	if charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "utf8") {
+		return w
+	}
+	return asciiWriter{w}
+}
+
+type asciiWriter struct {
+	io.Writer
+}
+
+func (w asciiWriter) Write(p []byte) (int, error) {
+	for i, c := range p {
+		if c >= utf8.RuneSelf {
+			n, err := w.Writer.Write(p[:i])
+			if err == nil {
+				err = ErrCharset
+			}
+			return n, err
+		}
+	}
+	return w.Writer.Write(p)
+}
+
+// RequestRenderer is implemented by renderers that need the request to render,
+// for example to read request-scoped values. Render calls RenderRequest instead of Render
+// if the renderer implements it.
+type RequestRenderer interface {
+	Renderer
+	RenderRequest(io.Writer, http.Header, *http.Request, interface{}) error
+}
+
+// JSONWriter is implemented by values that serialise themselves to JSON,
+// for example to write a large value incrementally without materialising it first.
+type JSONWriter interface {
+	WriteJSON(w io.Writer) error
+}
+
 // JSONRenderer serialises data to a JSON object.
+// Data that implements JSONWriter serialises itself and the other fields are ignored.
+// The X-Content-Type-Options: nosniff header is set unless DisableNosniff is set.
+//
+// Charset sets the charset parameter of the Content-Type header and defaults to utf-8.
+// The output is not transcoded, so rendering fails with ErrCharset if Charset
+// is not utf-8 and the output contains characters outside of US-ASCII.
 type JSONRenderer struct {
 	Prefix, Indent string
+	Charset        string
 	EscapeHTML     bool
+	DisableNosniff bool
 }
 
 // Render implements Renderer.
 func (r JSONRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
 	if h.Get("Content-Type") == "" {
-		h.Set("Content-Type", "application/json; charset=utf-8")
-		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Content-Type", "application/json; charset="+charsetOrUTF8(r.Charset))
+		if !r.DisableNosniff {
+			h.Set("X-Content-Type-Options", "nosniff")
+		}
+	}
+	w = charsetWriter(w, r.Charset)
+	if jw, ok := d.(JSONWriter); ok {
+		return jw.WriteJSON(w)
 	}
 	e := json.NewEncoder(w)
 	e.SetIndent(r.Prefix, r.Indent)
@@ -33,18 +124,127 @@ func (r JSONRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
 }
 
 // TemplateRenderer renders an HTML template.
+//
+// If InjectNonce is set, the template is executed with a TemplateData value
+// that holds the CSP nonce of the request and the data,
+// so that templates can reference the nonce without every handler passing it along:
+//  <script nonce="{{.Nonce}}">init({{.Data.Config}})</script>
+// InjectNonce only has effect when rendered by Render, because Render passes the request.
+// See ContentSecurityPolicy.
+//
+// The X-Content-Type-Options: nosniff header is set unless DisableNosniff is set.
+// Charset is described by JSONRenderer.
 type TemplateRenderer struct {
-	Template *template.Template
-	Name     string
+	Template       *template.Template
+	Name           string
+	Charset        string
+	InjectNonce    bool
+	DisableNosniff bool
+}
+
+// TemplateData is the value that templates are executed with when the nonce is injected.
+type TemplateData struct {
+	// Nonce is the CSP nonce of the request as returned by Nonce.
+	Nonce string
+
+	// Data is the data that was passed to Render.
+	Data interface{}
 }
 
 // Render implements Renderer.
 func (r TemplateRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
 	if h.Get("Content-Type") == "" {
-		h.Set("Content-Type", "text/html; charset=utf-8")
-		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Content-Type", "text/html; charset="+charsetOrUTF8(r.Charset))
+		if !r.DisableNosniff {
+			h.Set("X-Content-Type-Options", "nosniff")
+		}
+	}
+	return r.Template.ExecuteTemplate(charsetWriter(w, r.Charset), r.Name, d)
+}
+
+// RenderRequest implements RequestRenderer.
+func (r TemplateRenderer) RenderRequest(w io.Writer, h http.Header, req *http.Request, d interface{}) error {
+	if r.InjectNonce {
+		d = TemplateData{Nonce(req), d}
 	}
-	return r.Template.ExecuteTemplate(w, r.Name, d)
+	return r.Render(w, h, d)
+}
+
+// ReloadingTemplate renders an HTML template that is parsed from a file system.
+// The templates are parsed on first use and cached afterwards,
+// unless Reload is set in which case they are parsed again on every render.
+// Reload speeds up template development but must not be enabled in production.
+type ReloadingTemplate struct {
+	// FS is the file system to parse templates from.
+	FS fs.FS
+
+	// Patterns lists the glob patterns of the template files as accepted by fs.Glob.
+	Patterns []string
+
+	// Funcs is the function map added to the templates before parsing (optional).
+	Funcs template.FuncMap
+
+	// Name is the name of the template to execute.
+	Name string
+
+	// Reload parses the templates on every render if set.
+	Reload bool
+
+	// InjectNonce executes the templates with TemplateData as described by TemplateRenderer.
+	InjectNonce bool
+
+	mu   sync.Mutex
+	tmpl *template.Template
+}
+
+// MustReloadingTemplate parses the templates of rt and panics if that fails.
+// It is intended for detecting broken templates during initialisation.
+//
+//  renderer := httpsy.MustReloadingTemplate(&httpsy.ReloadingTemplate{
+//      FS:       os.DirFS("templates"),
+//      Patterns: []string{"*.html"},
+//      Name:     "index.html",
+//  })
+func MustReloadingTemplate(rt *ReloadingTemplate) *ReloadingTemplate {
+	if _, err := rt.Template(); err != nil {
+		panic(err)
+	}
+	return rt
+}
+
+// Template returns the parsed templates.
+func (rt *ReloadingTemplate) Template() (*template.Template, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.tmpl != nil && !rt.Reload {
+		return rt.tmpl, nil
+	}
+
+	tmpl, err := template.New(rt.Name).Funcs(rt.Funcs).ParseFS(rt.FS, rt.Patterns...)
+	if err != nil {
+		return nil, err
+	}
+	rt.tmpl = tmpl
+	return tmpl, nil
+}
+
+// Render implements Renderer.
+func (rt *ReloadingTemplate) Render(w io.Writer, h http.Header, d interface{}) error {
+	tmpl, err := rt.Template()
+	if err != nil {
+		return err
+	}
+	return TemplateRenderer{Template: tmpl, Name: rt.Name}.Render(w, h, d)
+}
+
+// RenderRequest implements RequestRenderer.
+func (rt *ReloadingTemplate) RenderRequest(w io.Writer, h http.Header, r *http.Request, d interface{}) error {
+	tmpl, err := rt.Template()
+	if err != nil {
+		return err
+	}
+	return TemplateRenderer{Template: tmpl, Name: rt.Name, InjectNonce: rt.InjectNonce}.RenderRequest(w, h, r, d)
 }
 
 var renderBufferPool = &sync.Pool{
@@ -52,18 +252,44 @@ var renderBufferPool = &sync.Pool{
 }
 
 // Render writes the header and renders the data to the response.
+// Renderers that implement RequestRenderer are passed the request.
 // If the renderer returns an error, the response will be an HTTP 500 internal server error.
 // The renderer is buffered so that no partial results become visible to the client.
+// The renderer is not called for status codes that do not permit a body (1xx, 204, 304).
+// Nothing is written if the request context is done by the time rendering has finished.
+// The data is first passed through the transform set with SetRenderTransform, if any,
+// unless the status code is an error status code.
 func Render(rr Renderer, w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	if !bodyAllowedForStatus(code) {
+		w.WriteHeader(code)
+		return
+	}
+
+	if transform, ok := r.Context().Value(renderTransformCtxKey).(func(interface{}) interface{}); ok && code < 400 {
+		data = transform(data)
+	}
+
 	b := renderBufferPool.Get().(*bytes.Buffer)
 	b.Reset()
 	defer renderBufferPool.Put(b)
 
-	if err := rr.Render(b, w.Header(), data); err != nil {
+	var err error
+	if rrr, ok := rr.(RequestRenderer); ok {
+		err = rrr.RenderRequest(b, w.Header(), r, data)
+	} else {
+		err = rr.Render(b, w.Header(), data)
+	}
+
+	if err != nil {
 		Error(w, r, err)
 		return
 	}
 
+	// do not bother writing to a client that has gone away
+	if r.Context().Err() != nil {
+		return
+	}
+
 	w.WriteHeader(code)
 	_, _ = b.WriteTo(w)
 }
@@ -72,3 +298,121 @@ func Render(rr Renderer, w http.ResponseWriter, r *http.Request, code int, data
 func JSON(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
 	Render(JSONRenderer{EscapeHTML: true}, w, r, code, data)
 }
+
+// XML is a convenience function that wraps XMLRenderer to reply with an XML document.
+func XML(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	Render(XMLRenderer{}, w, r, code, data)
+}
+
+// Created is a convenience function that replies with 201 created,
+// sets the Location header to the location of the new resource and renders the data as JSON.
+// The Location header is only set if the data renders successfully.
+//
+//  httpsy.Created(w, r, "/orders/"+order.ID, order)
+func Created(w http.ResponseWriter, r *http.Request, location string, data interface{}) {
+	Render(createdRenderer{JSONRenderer{EscapeHTML: true}, location}, w, r, http.StatusCreated, data)
+}
+
+type createdRenderer struct {
+	Renderer
+	location string
+}
+
+func (rr createdRenderer) Render(w io.Writer, h http.Header, d interface{}) error {
+	if err := rr.Renderer.Render(w, h, d); err != nil {
+		return err
+	}
+	h.Set("Location", rr.location)
+	return nil
+}
+
+// NotModified replies with 304 not modified to a conditional request.
+// The representation headers that must not be sent with a 304 response are removed,
+// while the headers that must be kept (Cache-Control, Content-Location, Date, ETag, Expires and Vary)
+// are preserved. Last-Modified is removed if an ETag is set, as the ETag takes precedence.
+func NotModified(w http.ResponseWriter, r *http.Request) {
+	// taken from net/http.writeNotModified
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Del("Transfer-Encoding")
+	if h.Get("Etag") != "" {
+		h.Del("Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// StatusCoder is implemented by values that determine their own HTTP status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// DataHandlerFunc is an http.Handler that returns the data to reply with instead of writing it.
+//
+// If the function returns an error, the response is written by Error.
+// Otherwise the data is rendered by Render. The data is rendered as JSON,
+// unless the data implements Renderer in which case it renders itself.
+// The status code is determined by DataStatus. Data that implements StatusCoder overrides the status code.
+// Use DataHandler to choose the status codes differently.
+//
+//  mux.Handle("/users", httpsy.DataHandlerFunc(func(r *http.Request) (interface{}, error) {
+//      return listUsers(r.Context())
+//  }))
+type DataHandlerFunc func(r *http.Request) (interface{}, error)
+
+// ServeHTTP implements http.Handler.
+func (fn DataHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	DataHandler{Func: fn}.ServeHTTP(w, r)
+}
+
+// DataHandler is like DataHandlerFunc but lets the status code of successful responses be configured.
+//
+//  mux.Handle("/search", httpsy.DataHandler{
+//      Func:   search,
+//      Status: func(*http.Request, interface{}) int { return http.StatusOK },
+//  })
+type DataHandler struct {
+	// Func returns the data to reply with.
+	Func func(r *http.Request) (interface{}, error)
+
+	// Status returns the status code for the data if it does not implement StatusCoder.
+	// It defaults to DataStatus.
+	Status func(r *http.Request, data interface{}) int
+}
+
+// DataStatus is the default status function of DataHandler.
+// It returns 204 No Content if the data is nil, 201 Created for POST requests and 200 OK otherwise.
+func DataStatus(r *http.Request, data interface{}) int {
+	if data == nil {
+		return http.StatusNoContent
+	} else if r.Method == http.MethodPost {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+// ServeHTTP implements http.Handler.
+func (h DataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := h.Func(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	var code int
+	if sc, ok := data.(StatusCoder); ok {
+		code = sc.StatusCode()
+	} else if h.Status != nil {
+		code = h.Status(r, data)
+	} else {
+		code = DataStatus(r, data)
+	}
+
+	var rr Renderer = JSONRenderer{EscapeHTML: true}
+	if v, ok := data.(Renderer); ok {
+		rr = v
+	}
+
+	Render(rr, w, r, code, data)
+}
@@ -0,0 +1,295 @@
+package httpsy
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+func TestReloadingTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": &fstest.MapFile{Data: []byte(`hello {{.}}`)},
+	}
+
+	rt := MustReloadingTemplate(&ReloadingTemplate{
+		FS:       fsys,
+		Patterns: []string{"*.html"},
+		Name:     "index.html",
+	})
+
+	render := func() string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		Render(rt, w, r, http.StatusOK, "gopher")
+		if w.Code != http.StatusOK {
+			t.Fatal(w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if s := render(); s != "hello gopher" {
+		t.Fatal(s)
+	}
+
+	fsys["index.html"].Data = []byte(`bye {{.}}`)
+	if s := render(); s != "hello gopher" {
+		t.Fatal(s)
+	}
+
+	rt.Reload = true
+	if s := render(); s != "bye gopher" {
+		t.Fatal(s)
+	}
+}
+
+func TestRenderNoContent(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	JSON(w, r, http.StatusNoContent, nil)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestRenderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	JSON(w, r, http.StatusOK, "gopher")
+	if w.Body.Len() != 0 {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestRenderTransform(t *testing.T) {
+	envelope := SetRenderTransform(func(data interface{}) interface{} {
+		return map[string]interface{}{"data": data}
+	})
+
+	x := envelope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			JSON(w, r, http.StatusConflict, "conflict")
+			return
+		} else if r.URL.Path == "/problem" {
+			Error(w, r, httpsyproblem.StatusNotFound)
+			return
+		}
+		JSON(w, r, http.StatusOK, []int{1, 2})
+	}))
+
+	for _, tt := range []struct {
+		path     string
+		expected string
+	}{
+		{"/", "{\"data\":[1,2]}\n"},
+		{"/error", "\"conflict\"\n"},
+		{"/problem", ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept", "application/json")
+		x.ServeHTTP(w, r)
+		if tt.expected != "" && w.Body.String() != tt.expected {
+			t.Fatal(tt.path, w.Body.String())
+		} else if tt.expected == "" && strings.Contains(w.Body.String(), "\"data\"") {
+			t.Fatal(tt.path, w.Body.String())
+		}
+	}
+}
+
+type acceptedData string
+
+func (acceptedData) StatusCode() int { return http.StatusAccepted }
+
+func TestDataHandlerFunc(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		data   interface{}
+		err    error
+		code   int
+		body   string
+	}{
+		{"GET", "gopher", nil, http.StatusOK, `"gopher"` + "\n"},
+		{"POST", "gopher", nil, http.StatusCreated, `"gopher"` + "\n"},
+		{"DELETE", nil, nil, http.StatusNoContent, ""},
+		{"PUT", acceptedData("gopher"), nil, http.StatusAccepted, `"gopher"` + "\n"},
+		{"GET", nil, httpsyproblem.StatusNotFound, http.StatusNotFound, "Not Found\n"},
+	} {
+		x := DataHandlerFunc(func(r *http.Request) (interface{}, error) {
+			return tt.data, tt.err
+		})
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, "/", nil)
+		x.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Fatal(tt.method, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDataHandlerStatus(t *testing.T) {
+	x := DataHandler{
+		Func: func(r *http.Request) (interface{}, error) {
+			return "gopher", nil
+		},
+		Status: func(*http.Request, interface{}) int {
+			return http.StatusOK
+		},
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	x.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != `"gopher"`+"\n" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestCreated(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/orders", nil)
+	Created(w, r, "/orders/42", map[string]int{"id": 42})
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":42}`+"\n" {
+		t.Fatal(w.Code, w.Body.String())
+	} else if w.Header().Get("Location") != "/orders/42" {
+		t.Fatal(w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	Created(w, r, "/orders/42", func() {})
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Location") != "" {
+		t.Fatal(w.Code, w.Header().Get("Location"))
+	}
+}
+
+type countJSON int
+
+func (n countJSON) WriteJSON(w io.Writer) error {
+	_, _ = io.WriteString(w, "[")
+	for i := 0; i < int(n); i++ {
+		if i > 0 {
+			_, _ = io.WriteString(w, ",")
+		}
+		_, _ = io.WriteString(w, strconv.Itoa(i))
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+func TestJSONWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	JSON(w, r, http.StatusOK, countJSON(3))
+	if w.Body.String() != "[0,1,2]" || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", "42")
+	w.Header().Set("ETag", `"v1"`)
+	w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.Header().Set("Vary", "Accept")
+	NotModified(w, r)
+
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatal(w.Code)
+	}
+
+	assertHeaders(t, w.Header(), map[string]string{
+		"Content-Type":   "",
+		"Content-Length": "",
+		"Last-Modified":  "",
+		"ETag":           `"v1"`,
+		"Cache-Control":  "max-age=60",
+		"Vary":           "Accept",
+	})
+}
+
+func TestDisableNosniff(t *testing.T) {
+	for _, rr := range []Renderer{
+		JSONRenderer{DisableNosniff: true},
+		TemplateRenderer{Template: template.Must(template.New("").Parse("{{.}}")), DisableNosniff: true},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		Render(rr, w, r, http.StatusOK, "hello")
+		if w.Header().Get("Content-Type") == "" || w.Header().Get("X-Content-Type-Options") != "" {
+			t.Fatal(w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	JSON(w, r, http.StatusOK, "hello")
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestXML(t *testing.T) {
+	type item struct {
+		XMLName struct{} `xml:"item"`
+		ID      int      `xml:"id,attr"`
+		Name    string   `xml:"name"`
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	XML(w, r, http.StatusOK, item{ID: 1, Name: "widget"})
+
+	if w.Code != http.StatusOK || w.Body.String() != `<item id="1"><name>widget</name></item>` {
+		t.Fatal(w.Code, w.Body.String())
+	} else if w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatal(w.Header())
+	} else if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatal(w.Header())
+	}
+
+	// unsupported types fail without writing a partial body
+	w = httptest.NewRecorder()
+	r.Header.Set("Accept", "application/json")
+	XML(w, r, http.StatusOK, map[string]int{"a": 1})
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "<") {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestRendererCharset(t *testing.T) {
+	for _, tt := range []struct {
+		renderer    Renderer
+		contentType string
+	}{
+		{JSONRenderer{Charset: "us-ascii"}, "application/json; charset=us-ascii"},
+		{XMLRenderer{Charset: "us-ascii"}, "application/xml; charset=us-ascii"},
+		{TemplateRenderer{Template: template.Must(template.New("").Parse("{{.}}")), Charset: "us-ascii"}, "text/html; charset=us-ascii"},
+	} {
+		var b bytes.Buffer
+		h := http.Header{}
+		if err := tt.renderer.Render(&b, h, "hello"); err != nil {
+			t.Fatal(err)
+		} else if h.Get("Content-Type") != tt.contentType {
+			t.Fatal(h.Get("Content-Type"))
+		}
+
+		if err := tt.renderer.Render(&b, http.Header{}, "héllo"); err != ErrCharset {
+			t.Fatal(tt.contentType, err)
+		}
+	}
+}
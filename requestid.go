@@ -0,0 +1,74 @@
+package httpsy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header that carries the request ID.
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID is a middleware that assigns an ID to every request so that it can be correlated
+// across log lines and services. The ID is taken from the X-Request-Id request header if present
+// and generated randomly otherwise. It is echoed in the X-Request-Id response header
+// and stored in the request context, where it can be read with RequestIDFrom.
+//
+// Only trust the request header if the server is behind a proxy that sets or sanitizes it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 200 {
+			var b [16]byte
+			if _, err := rand.Read(b[:]); err != nil {
+				Error(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b[:])
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, WithContextValue(r, requestIDCtxKey, id))
+	})
+}
+
+// RequestIDFrom returns the request ID stored in ctx by RequestID, or the empty string if there is none.
+// It takes a context instead of a request so that code without access to the request can use it.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey).(string)
+	return id
+}
+
+// PropagateRequestID sets the X-Request-Id header of the outbound request to the request ID in ctx,
+// so that downstream services can correlate their logs with the incoming request.
+// It does nothing if ctx has no request ID or if the header is already set.
+func PropagateRequestID(ctx context.Context, req *http.Request) {
+	if id := RequestIDFrom(ctx); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// RequestIDTransport is an http.RoundTripper that propagates the request ID
+// from the context of every outbound request, which should be derived from the incoming request:
+//  client := &http.Client{Transport: httpsy.RequestIDTransport{}}
+//  req, _ := http.NewRequestWithContext(r.Context(), "GET", "http://inventory/items", nil)
+//  resp, err := client.Do(req)
+type RequestIDTransport struct {
+	// Base is the underlying transport. It defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if id := RequestIDFrom(req.Context()); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		// round trippers must not modify the request
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+	return base.RoundTrip(req)
+}
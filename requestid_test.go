@@ -0,0 +1,65 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
+
+func TestRequestID(t *testing.T) {
+	var id string
+	x := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestIDFrom(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	x.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(id) != 32 || w.Header().Get("X-Request-Id") != id {
+		t.Fatal(id, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "abc")
+	x.ServeHTTP(w, r)
+	if id != "abc" || w.Header().Get("X-Request-Id") != "abc" {
+		t.Fatal(id, w.Header())
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var outbound string
+	client := &http.Client{Transport: RequestIDTransport{
+		Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			outbound = req.Header.Get("X-Request-Id")
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+	}}
+
+	x := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", "http://inventory/items", nil)
+		if _, err := client.Do(req); err != nil {
+			t.Fatal(err)
+		} else if req.Header.Get("X-Request-Id") != "" {
+			t.Fatal("outbound request was modified")
+		}
+
+		req2, _ := http.NewRequest("GET", "http://inventory/items", nil)
+		PropagateRequestID(r.Context(), req2)
+		if req2.Header.Get("X-Request-Id") != "abc" {
+			t.Fatal(req2.Header)
+		}
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "abc")
+	x.ServeHTTP(httptest.NewRecorder(), r)
+
+	if outbound != "abc" {
+		t.Fatal(outbound)
+	}
+}
@@ -0,0 +1,133 @@
+package httpsy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerTimings collects the metrics of a request for the Server-Timing response header,
+// which shows backend timings in the developer tools of browsers.
+// It is safe for concurrent use and its methods do nothing if it is nil.
+type ServerTimings struct {
+	mu      sync.Mutex
+	metrics []serverTimingMetric
+}
+
+type serverTimingMetric struct {
+	name, desc string
+	dur        time.Duration
+}
+
+// WithServerTiming is a middleware that installs a ServerTimings in the request context
+// and writes its metrics to the Server-Timing header right before the response header is written.
+// Handlers record metrics by calling the methods of the value returned by ServerTiming.
+//
+//  defer httpsy.ServerTiming(r).Start("db")()
+func WithServerTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := &ServerTimings{}
+		sw := &serverTimingWriter{ResponseWriter: w, st: st}
+		next.ServeHTTP(sw, WithContextValue(r, serverTimingCtxKey, st))
+		if !sw.wroteHeader {
+			sw.writeTimings()
+		}
+	})
+}
+
+// ServerTiming returns the ServerTimings installed by WithServerTiming, or nil if there is none.
+func ServerTiming(r *http.Request) *ServerTimings {
+	st, _ := r.Context().Value(serverTimingCtxKey).(*ServerTimings)
+	return st
+}
+
+// Add records a metric with the given name and duration.
+func (st *ServerTimings) Add(name string, d time.Duration) {
+	st.AddDesc(name, "", d)
+}
+
+// AddDesc records a metric with the given name, description and duration.
+func (st *ServerTimings) AddDesc(name, desc string, d time.Duration) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	st.metrics = append(st.metrics, serverTimingMetric{name, desc, d})
+	st.mu.Unlock()
+}
+
+// Start starts timing a phase and returns a function that records it when called.
+func (st *ServerTimings) Start(name string) func() {
+	start := time.Now()
+	return func() {
+		st.Add(name, time.Since(start))
+	}
+}
+
+// String formats the metrics as the value of the Server-Timing header,
+// for example db;dur=53.2, render;desc="Render page";dur=8.
+func (st *ServerTimings) String() string {
+	if st == nil {
+		return ""
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var sb strings.Builder
+	for i, m := range st.metrics {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(m.name)
+		if m.desc != "" {
+			sb.WriteString(";desc=")
+			sb.WriteString(strconv.Quote(m.desc))
+		}
+		sb.WriteString(";dur=")
+		sb.WriteString(strconv.FormatFloat(float64(m.dur.Microseconds())/1000, 'f', -1, 64))
+	}
+	return sb.String()
+}
+
+type serverTimingWriter struct {
+	http.ResponseWriter
+	st          *ServerTimings
+	wroteHeader bool
+}
+
+func (w *serverTimingWriter) writeTimings() {
+	w.wroteHeader = true
+	if v := w.st.String(); v != "" {
+		w.Header().Add("Server-Timing", v)
+	}
+}
+
+func (w *serverTimingWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader && statusCode >= 200 {
+		w.writeTimings()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *serverTimingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *serverTimingWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := flusher(w.ResponseWriter); ok {
+		f.Flush()
+	}
+}
+
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
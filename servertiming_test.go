@@ -0,0 +1,42 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerTiming(t *testing.T) {
+	x := WithServerTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := ServerTiming(r)
+		st.Add("db", 53200*time.Microsecond)
+		st.AddDesc("render", "Render page", 8*time.Millisecond)
+		w.Write([]byte("hello"))
+		st.Add("late", time.Millisecond)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	x.ServeHTTP(w, r)
+
+	expected := `db;dur=53.2, render;desc="Render page";dur=8`
+	if v := w.Header().Get("Server-Timing"); v != expected {
+		t.Fatal(v)
+	}
+
+	// recording without the middleware does nothing
+	ServerTiming(r).Start("noop")()
+}
+
+func TestServerTimingNoBody(t *testing.T) {
+	x := WithServerTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServerTiming(r).Add("total", time.Millisecond)
+	}))
+
+	w := httptest.NewRecorder()
+	x.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if v := w.Header().Get("Server-Timing"); v != "total;dur=1" {
+		t.Fatal(v)
+	}
+}
@@ -0,0 +1,129 @@
+package httpsy
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// SingleFlight is a middleware that coalesces concurrent identical requests,
+// so that a thundering herd of requests for an expensive resource runs the handler only once.
+// The first request runs the handler while the response is buffered,
+// and the response is replayed to every request with the same key that arrived in the meantime.
+// Only GET and HEAD requests are coalesced.
+//
+// If the client of the first request goes away before the handler has finished,
+// the waiting requests run the handler themselves instead of replaying an incomplete response.
+//
+// The default key is the method, host and URL, which is only correct if the response
+// does not depend on anything else, such as the user or the Accept header.
+// Set KeyFunc to include those parts of the request that the response depends on.
+//
+//  sf := &httpsy.SingleFlight{}
+//  mux.Handle("/report", sf.Handle(reportHandler))
+type SingleFlight struct {
+	// KeyFunc returns the key that identifies identical requests (optional).
+	KeyFunc func(*http.Request) string
+
+	mu    sync.Mutex
+	calls map[string]*singleFlightCall
+}
+
+type singleFlightCall struct {
+	done      chan struct{}
+	rec       *bufferedResponse
+	cancelled bool
+}
+
+// Handle returns a middleware handler that coalesces identical requests.
+func (sf *SingleFlight) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Method + " " + r.Host + r.URL.String()
+		if sf.KeyFunc != nil {
+			key = sf.KeyFunc(r)
+		}
+
+		sf.mu.Lock()
+		if sf.calls == nil {
+			sf.calls = map[string]*singleFlightCall{}
+		}
+
+		if call, ok := sf.calls[key]; ok {
+			sf.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				return
+			}
+			if call.cancelled {
+				// the response of the first request may be incomplete
+				next.ServeHTTP(w, r)
+				return
+			} else if call.rec.status == 0 {
+				// the handler panicked
+				Error(w, r, httpsyproblem.StatusInternalServerError)
+				return
+			}
+			call.rec.replay(w)
+			return
+		}
+
+		call := &singleFlightCall{done: make(chan struct{}), rec: &bufferedResponse{header: http.Header{}}}
+		sf.calls[key] = call
+		sf.mu.Unlock()
+
+		func() {
+			defer func() {
+				call.cancelled = r.Context().Err() != nil
+				sf.mu.Lock()
+				delete(sf.calls, key)
+				sf.mu.Unlock()
+				close(call.done)
+			}()
+			next.ServeHTTP(call.rec, r)
+			if call.rec.status == 0 {
+				call.rec.status = http.StatusOK
+			}
+		}()
+
+		call.rec.replay(w)
+	})
+}
+
+// bufferedResponse is an http.ResponseWriter that buffers the response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponse) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *bufferedResponse) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *bufferedResponse) replay(dst http.ResponseWriter) {
+	h := dst.Header()
+	for k, v := range w.header {
+		h[k] = append([]string(nil), v...)
+	}
+	dst.WriteHeader(w.status)
+	_, _ = dst.Write(w.body.Bytes())
+}
@@ -0,0 +1,148 @@
+package httpsy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlight(t *testing.T) {
+	var calls, entered int32
+	release := make(chan struct{})
+
+	sf := &SingleFlight{}
+	h := sf.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("X-Report", "1")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("report"))
+	}))
+
+	x := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&entered, 1)
+		h.ServeHTTP(w, r)
+	})
+
+	const n = 10
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, n)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			x.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+		}(recorders[i])
+	}
+
+	// wait until all requests are waiting on the first one
+	for atomic.LoadInt32(&entered) < n || atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatal("handler ran", calls, "times")
+	}
+
+	for _, w := range recorders {
+		if w.Code != http.StatusAccepted || w.Body.String() != "report" || w.Header().Get("X-Report") != "1" {
+			t.Fatal(w.Code, w.Body.String(), w.Header())
+		}
+	}
+}
+
+func TestSingleFlightUnsafeMethod(t *testing.T) {
+	var calls int32
+	sf := &SingleFlight{}
+	x := sf.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+
+	for i := 0; i < 2; i++ {
+		x.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	}
+
+	if calls != 2 {
+		t.Fatal(calls)
+	}
+}
+
+func TestSingleFlightCancelled(t *testing.T) {
+	var calls int32
+	started := make(chan struct{})
+
+	sf := &SingleFlight{}
+	x := sf.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("report"))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		x.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/report", nil).WithContext(ctx))
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	waiter := make(chan struct{})
+	go func() {
+		defer close(waiter)
+		x.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-first
+	<-waiter
+
+	if w.Code != http.StatusOK || w.Body.String() != "report" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestSingleFlightHost(t *testing.T) {
+	release := make(chan struct{})
+	sf := &SingleFlight{}
+	x := sf.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(r.Host))
+	}))
+
+	var wg sync.WaitGroup
+	hosts := []string{"a.example", "b.example"}
+	recorders := make([]*httptest.ResponseRecorder, len(hosts))
+	for i, host := range hosts {
+		recorders[i] = httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/report", nil)
+		r.Host = host
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder, r *http.Request) {
+			defer wg.Done()
+			x.ServeHTTP(w, r)
+		}(recorders[i], r)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, w := range recorders {
+		if w.Body.String() != hosts[i] {
+			t.Fatal(hosts[i], w.Body.String())
+		}
+	}
+}
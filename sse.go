@@ -0,0 +1,105 @@
+package httpsy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidEventName is returned by SSEWriter.Send if the event name contains a line break.
+var ErrInvalidEventName = errors.New("httpsy: event name contains a line break")
+
+// sseLineBreaks normalizes the line terminators of the event stream format to LF.
+var sseLineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// SSEWriter sends Server-Sent Events to the client.
+type SSEWriter struct {
+	w   http.ResponseWriter
+	f   http.Flusher
+	ctx context.Context
+}
+
+// ServeSSE prepares the response for a stream of Server-Sent Events
+// and writes the header with status 200 OK.
+// It returns http.ErrNotSupported if w cannot be flushed, in which case nothing is written.
+//
+//  sse, err := httpsy.ServeSSE(w, r)
+//  if err != nil {
+//      httpsy.Error(w, r, err)
+//      return
+//  }
+//  for {
+//      select {
+//      case msg := <-messages:
+//          if err := sse.Send("message", msg); err != nil {
+//              return
+//          }
+//      case <-sse.Done():
+//          return
+//      }
+//  }
+func ServeSSE(w http.ResponseWriter, r *http.Request) (*SSEWriter, error) {
+	f, ok := flusher(w)
+	if !ok {
+		return nil, http.ErrNotSupported
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	return &SSEWriter{w: w, f: f, ctx: r.Context()}, nil
+}
+
+// Done returns a channel that is closed when the client disconnects.
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send sends an event with the given data and flushes it to the client.
+// The event line is omitted if event is empty, so that the client dispatches a message event.
+// Data that spans multiple lines is sent as multiple data lines,
+// where CRLF, CR and LF are all recognized as line breaks.
+// It returns ErrInvalidEventName if event contains a CR or LF,
+// and the context error if the client has disconnected.
+func (s *SSEWriter) Send(event, data string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	} else if strings.ContainsAny(event, "\r\n") {
+		return ErrInvalidEventName
+	}
+
+	var sb strings.Builder
+	if event != "" {
+		sb.WriteString("event: ")
+		sb.WriteString(event)
+		sb.WriteByte('\n')
+	}
+	for _, line := range strings.Split(sseLineBreaks.Replace(data), "\n") {
+		sb.WriteString("data: ")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+
+	if _, err := s.w.Write([]byte(sb.String())); err != nil {
+		return err
+	}
+	s.f.Flush()
+	return nil
+}
+
+// SendJSON sends an event with v encoded as JSON as the data.
+func (s *SSEWriter) SendJSON(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(event, string(data))
+}
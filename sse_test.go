@@ -0,0 +1,85 @@
+package httpsy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeSSE(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	sse, err := ServeSSE(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sse.Send("", "hello\nworld"); err != nil {
+		t.Fatal(err)
+	} else if err := sse.SendJSON("update", map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "data: hello\ndata: world\n\nevent: update\ndata: {\"id\":1}\n\n"
+	if w.Body.String() != expected || !w.Flushed {
+		t.Fatal(w.Body.String())
+	} else if w.Header().Get("Content-Type") != "text/event-stream" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestServeSSELineBreaks(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	sse, err := ServeSSE(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sse.Send("", "a\revent: admin\r\nid: 1\nb"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "data: a\ndata: event: admin\ndata: id: 1\ndata: b\n\n"
+	if w.Body.String() != expected {
+		t.Fatalf("%q", w.Body.String())
+	}
+
+	for _, event := range []string{"update\nid: 1", "update\rdata: x"} {
+		if err := sse.Send(event, "x"); err != ErrInvalidEventName {
+			t.Fatal(event, err)
+		}
+	}
+	if w.Body.String() != expected {
+		t.Fatalf("%q", w.Body.String())
+	}
+}
+
+func TestServeSSEDisconnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	sse, err := ServeSSE(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	<-sse.Done()
+	if err := sse.Send("", "hello"); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+func TestServeSSENotSupported(t *testing.T) {
+	var w struct{ http.ResponseWriter }
+	w.ResponseWriter = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, err := ServeSSE(w, r); err != http.ErrNotSupported {
+		t.Fatal(err)
+	}
+}
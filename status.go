@@ -0,0 +1,76 @@
+package httpsy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+var statusErrors sync.Map
+
+// nonStandardStatusText holds the titles of common status codes that net/http does not know.
+var nonStandardStatusText = map[int]string{
+	444: "Connection Closed Without Response",
+	499: "Client Closed Request",
+}
+
+// statusProblem is like httpsyproblem.Wrap but also supplies a title for non-standard status codes.
+func statusProblem(code int, err error) error {
+	d := httpsyproblem.New(code, err)
+	if d.Title == "" {
+		d.Title = nonStandardStatusText[code]
+	}
+	return d
+}
+
+// Status returns an error that responds with the given status code when passed to Error.
+// It is intended for status codes that are not predeclared by httpsyproblem,
+// such as 499 Client Closed Request. The errors are cached per status code.
+// The title of the problem is the status text, which is also known for
+// 444 Connection Closed Without Response and 499 Client Closed Request.
+//
+//  httpsy.Error(w, r, httpsy.Status(499))
+func Status(code int) error {
+	if err, ok := statusErrors.Load(code); ok {
+		return err.(error)
+	}
+	err, _ := statusErrors.LoadOrStore(code, statusProblem(code, nil))
+	return err.(error)
+}
+
+// StatusCode returns the HTTP status code of err like httpsyproblem.StatusCode
+// but also recognizes common standard library errors that carry no status code:
+//  context.DeadlineExceeded  504 gateway timeout
+//  context.Canceled          499 client closed request
+//  os.ErrNotExist            404 not found
+//  *http.MaxBytesError       413 request entity too large (Go 1.19 and later)
+// Error applies the same mapping, so handlers can pass these errors to it directly.
+func StatusCode(err error) int {
+	return httpsyproblem.StatusCode(stdlibError(err))
+}
+
+// stdlibError wraps well-known standard library errors with a status code.
+// Errors that already have a status code are returned unchanged.
+func stdlibError(err error) error {
+	var sc interface{ StatusCode() int }
+	if err == nil || errors.As(err, &sc) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return httpsyproblem.Wrap(http.StatusGatewayTimeout, err)
+	case errors.Is(err, context.Canceled):
+		return statusProblem(499, err)
+	case errors.Is(err, os.ErrNotExist):
+		return httpsyproblem.Wrap(http.StatusNotFound, err)
+	case isMaxBytesError(err):
+		return httpsyproblem.Wrap(http.StatusRequestEntityTooLarge, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,59 @@
+package httpsy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+func TestStatus(t *testing.T) {
+	err := Status(499)
+	if httpsyproblem.StatusCode(err) != 499 {
+		t.Fatal(httpsyproblem.StatusCode(err))
+	} else if Status(499) != err {
+		t.Fatal("not cached")
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	Error(w, r, err)
+	if w.Code != 499 || !strings.Contains(w.Body.String(), `"title":"Client Closed Request"`) {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	if err := Status(http.StatusTeapot); err.Error() != "I'm a teapot" {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusCodeStdlib(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{context.Canceled, 499},
+		{os.ErrNotExist, http.StatusNotFound},
+		{fmt.Errorf("open: %w", os.ErrNotExist), http.StatusNotFound},
+		{os.ErrPermission, http.StatusInternalServerError},
+		{httpsyproblem.Wrap(http.StatusConflict, os.ErrNotExist), http.StatusConflict},
+	} {
+		if code := StatusCode(tt.err); code != tt.code {
+			t.Fatal(tt.err, code)
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		Error(w, r, tt.err)
+		if w.Code != tt.code {
+			t.Fatal(tt.err, w.Code)
+		}
+	}
+}
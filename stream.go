@@ -0,0 +1,102 @@
+package httpsy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Stream is a writer that sends every write to the client immediately.
+type Stream struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+// Streamer returns a Stream that writes chunked output to w,
+// such as progress messages of a long-running operation.
+// The Content-Length header is removed and X-Content-Type-Options is set to nosniff
+// to prevent the client from buffering the response while sniffing it.
+// It returns http.ErrNotSupported if w cannot be flushed, so that the handler can fall back.
+//
+//  s, err := httpsy.Streamer(w, r)
+//  if err != nil {
+//      httpsy.Error(w, r, err)
+//      return
+//  }
+//  fmt.Fprintf(s, "%d%%\n", progress)
+func Streamer(w http.ResponseWriter, r *http.Request) (*Stream, error) {
+	f, ok := flusher(w)
+	if !ok {
+		return nil, http.ErrNotSupported
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	return &Stream{w: w, f: f}, nil
+}
+
+// Write writes p to the client and flushes it.
+func (s *Stream) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err == nil {
+		s.f.Flush()
+	}
+	return n, err
+}
+
+// Flush sends any buffered data to the client.
+func (s *Stream) Flush() {
+	s.f.Flush()
+}
+
+// StreamJSON writes the values received from ch to the response as newline-delimited JSON
+// (application/x-ndjson) until ch is closed, without buffering the whole result set in memory.
+// The header is written with the status code immediately and every value is flushed
+// to the client as soon as it is encoded, if w supports flushing.
+//
+// Because the header has already been sent, an error in the middle of the stream
+// cannot change the status code. StreamJSON stops and returns the error if a value cannot
+// be encoded or written, or if the request context is done. The handler should log the error,
+// and the producer should stop sending when the request context is done,
+// because ch is not drained after StreamJSON returns.
+//
+//  ch := make(chan interface{})
+//  go func() {
+//      defer close(ch)
+//      for rows.Next() {
+//          select {
+//          case ch <- scanRow(rows):
+//          case <-r.Context().Done():
+//              return
+//          }
+//      }
+//  }()
+//  if err := httpsy.StreamJSON(w, r, http.StatusOK, ch); err != nil {
+//      log.Println(err)
+//  }
+func StreamJSON(w http.ResponseWriter, r *http.Request, code int, ch <-chan interface{}) error {
+	h := w.Header()
+	h.Set("Content-Type", "application/x-ndjson")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Del("Content-Length")
+	w.WriteHeader(code)
+
+	f, canFlush := flusher(w)
+	if canFlush {
+		f.Flush()
+	}
+
+	e := json.NewEncoder(w)
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return nil
+			} else if err := e.Encode(v); err != nil {
+				return err
+			} else if canFlush {
+				f.Flush()
+			}
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
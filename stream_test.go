@@ -0,0 +1,85 @@
+package httpsy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type unwrapResponseWriter struct {
+	rw http.ResponseWriter
+}
+
+func (w unwrapResponseWriter) Header() http.Header         { return w.rw.Header() }
+func (w unwrapResponseWriter) Write(p []byte) (int, error) { return w.rw.Write(p) }
+func (w unwrapResponseWriter) WriteHeader(statusCode int)  { w.rw.WriteHeader(statusCode) }
+func (w unwrapResponseWriter) Unwrap() http.ResponseWriter { return w.rw }
+
+func TestStreamer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Length", "10")
+	r := httptest.NewRequest("GET", "/", nil)
+
+	s, err := Streamer(unwrapResponseWriter{rec}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(s, "50%")
+	if !rec.Flushed || rec.Body.String() != "50%" {
+		t.Fatal(rec.Body.String())
+	}
+
+	assertHeaders(t, rec.Header(), map[string]string{
+		"Content-Length":         "",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+func TestStreamerNotSupported(t *testing.T) {
+	var w struct{ http.ResponseWriter }
+	w.ResponseWriter = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, err := Streamer(w, r); err != http.ErrNotSupported {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 3; i++ {
+			ch <- map[string]int{"id": i}
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := StreamJSON(w, r, http.StatusOK, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"
+	if w.Code != http.StatusOK || w.Body.String() != expected || !w.Flushed {
+		t.Fatal(w.Code, w.Body.String())
+	} else if w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestStreamJSONEncodeError(t *testing.T) {
+	ch := make(chan interface{}, 2)
+	ch <- 1
+	ch <- func() {}
+	close(ch)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := StreamJSON(w, r, http.StatusOK, ch); err == nil {
+		t.Fatal("expected error")
+	} else if w.Code != http.StatusOK || w.Body.String() != "1\n" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,130 @@
+package httpsy
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/askeladdk/httpsyproblem"
+)
+
+// Timeout is a middleware that aborts handlers that take longer than d to complete.
+// The request context is given a deadline of d, and if the handler has not returned by then
+// the middleware responds with HTTP 503 service unavailable by calling Error.
+// It is similar to http.TimeoutHandler, but the response is produced by the error handler
+// set with SetErrorHandler. If the client goes away first, Error is called with context.Canceled.
+//
+// The response is buffered so that a handler that is still running after the timeout
+// cannot corrupt the timeout response. Writes after the timeout return http.ErrHandlerTimeout.
+// Handlers should observe the request context to stop doing work that is no longer needed.
+// Panics in the handler are propagated to the goroutine that called the middleware.
+// A panic that happens after the timeout response was sent can no longer be propagated,
+// so it is recovered and logged with the standard log package together with its stack trace.
+//
+// Because the response is buffered, handlers cannot flush or hijack the connection.
+// Requests that ask for a connection upgrade (such as websockets) or an event stream
+// are therefore passed on without a timeout. Other streaming handlers should not be wrapped.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						tw.mu.Lock()
+						defer tw.mu.Unlock()
+						if !tw.timedOut {
+							panicked <- p
+						} else if p != http.ErrAbortHandler {
+							log.Printf("httpsy: panic in handler after timeout: %v\n%s", p, debug.Stack())
+						}
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				_, _ = tw.buf.WriteTo(w)
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				select {
+				case p := <-panicked:
+					panic(p)
+				default:
+				}
+				tw.timedOut = true
+				if err := ctx.Err(); err == context.DeadlineExceeded {
+					Error(w, r, httpsyproblem.StatusServiceUnavailable)
+				} else {
+					Error(w, r, err)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a handler wrapped by Timeout.
+// It deliberately does not implement Flush or Unwrap
+// so that the handler cannot write to the underlying connection.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.code == 0 && !w.timedOut && statusCode >= 200 {
+		w.code = statusCode
+	}
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,89 @@
+package httpsy
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	x := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Fatal("no deadline")
+		}
+		w.Header().Set("X-Test", "1")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("done"))
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	x.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted || w.Body.String() != "done" || w.Header().Get("X-Test") != "1" {
+		t.Fatal(w.Code, w.Body.String(), w.Header())
+	}
+}
+
+func TestTimeoutSlow(t *testing.T) {
+	written := make(chan error, 1)
+	timedOut := make(chan struct{})
+	x := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-timedOut
+		w.Header().Set("X-Test", "1")
+		_, err := w.Write([]byte("too late"))
+		written <- err
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	x.ServeHTTP(w, r)
+	close(timedOut)
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("X-Test") != "" {
+		t.Fatal(w.Code, w.Header())
+	} else if err := <-written; err != http.ErrHandlerTimeout {
+		t.Fatal(err)
+	}
+}
+
+type logWriter chan string
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestTimeoutSlowPanic(t *testing.T) {
+	logged := make(logWriter, 1)
+	log.SetOutput(logged)
+	defer log.SetOutput(os.Stderr)
+
+	timedOut := make(chan struct{})
+	x := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-timedOut
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	x.ServeHTTP(w, r)
+	close(timedOut)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatal(w.Code)
+	}
+
+	select {
+	case s := <-logged:
+		if !strings.Contains(s, "panic in handler after timeout: boom") {
+			t.Fatal(s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic was not logged")
+	}
+}
@@ -0,0 +1,136 @@
+package httpsy
+
+import (
+	"net/http"
+	"time"
+)
+
+// WriteTracker is an http.ResponseWriter that records whether
+// the response header has been written, with which status code and when,
+// and how many bytes of the body have been written.
+type WriteTracker struct {
+	http.ResponseWriter
+	status    int
+	n         int64
+	start     time.Time
+	firstByte time.Time
+}
+
+// WithWriteTracker is a middleware that installs a WriteTracker.
+// Middleware further down the chain can retrieve it with WriteTrackerFrom.
+func WithWriteTracker(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := WriteTrackerFrom(w); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&WriteTracker{ResponseWriter: w, start: time.Now()}, r)
+	})
+}
+
+// WriteTrackerFrom returns the WriteTracker that was installed by WithWriteTracker
+// by following the Unwrap chain of w.
+func WriteTrackerFrom(w http.ResponseWriter) (*WriteTracker, bool) {
+	for {
+		if t, ok := w.(*WriteTracker); ok {
+			return t, true
+		} else if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+			w = u.Unwrap()
+		} else {
+			return nil, false
+		}
+	}
+}
+
+// Written reports whether the response header has been written.
+func (w *WriteTracker) Written() bool {
+	return w.status != 0
+}
+
+// Status returns the status code that was written, or zero if the header has not been written.
+func (w *WriteTracker) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of body bytes written.
+func (w *WriteTracker) BytesWritten() int64 {
+	return w.n
+}
+
+// TimeToFirstByte returns the duration between the installation of the tracker
+// and the moment that the response header was written, or zero if it has not been written.
+// It measures how long the handler took before it started responding.
+func (w *WriteTracker) TimeToFirstByte() time.Duration {
+	if w.firstByte.IsZero() {
+		return 0
+	}
+	return w.firstByte.Sub(w.start)
+}
+
+func (w *WriteTracker) written(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+		w.firstByte = time.Now()
+	}
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *WriteTracker) WriteHeader(statusCode int) {
+	if statusCode >= 200 {
+		w.written(statusCode)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter.
+func (w *WriteTracker) Write(p []byte) (int, error) {
+	w.written(http.StatusOK)
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *WriteTracker) Flush() {
+	w.written(http.StatusOK)
+	if f, ok := flusher(w.ResponseWriter); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *WriteTracker) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// OnError is a middleware that calls fn after the next handler has completed
+// if the response status code is 400 or greater.
+// It observes the outcome of the request regardless of how the response was produced,
+// which makes it suitable for alerting and metrics.
+func OnError(fn func(r *http.Request, status int)) func(http.Handler) http.Handler {
+	return OnStatus(http.StatusBadRequest, fn)
+}
+
+// OnStatus is like OnError but calls fn if the response status code is min or greater.
+func OnStatus(min int, fn func(r *http.Request, status int)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tracker, ok := WriteTrackerFrom(w)
+			if !ok {
+				tracker = &WriteTracker{ResponseWriter: w, start: time.Now()}
+				w = tracker
+			}
+
+			next.ServeHTTP(w, r)
+
+			status := tracker.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status >= min {
+				fn(r, status)
+			}
+		})
+	}
+}
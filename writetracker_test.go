@@ -0,0 +1,74 @@
+package httpsy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteTracker(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker, ok := WriteTrackerFrom(unwrapResponseWriter{w})
+		if !ok || tracker.Written() {
+			t.Fatal("tracker")
+		}
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("hello"))
+		if !tracker.Written() || tracker.Status() != http.StatusTeapot || tracker.BytesWritten() != 5 {
+			t.Fatal(tracker.Status(), tracker.BytesWritten())
+		}
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	WithWriteTracker(WithWriteTracker(endpoint)).ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Fatal(w.Code)
+	}
+
+	if _, ok := WriteTrackerFrom(w); ok {
+		t.Fatal("recorder is not a tracker")
+	}
+}
+
+func TestOnError(t *testing.T) {
+	var calls []int
+	onError := OnError(func(r *http.Request, status int) {
+		calls = append(calls, status)
+	})
+
+	for _, code := range []int{http.StatusOK, http.StatusInternalServerError, http.StatusNotFound} {
+		code := code
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		onError(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})).ServeHTTP(w, r)
+	}
+
+	if len(calls) != 2 || calls[0] != http.StatusInternalServerError || calls[1] != http.StatusNotFound {
+		t.Fatal(calls)
+	}
+}
+
+func TestWriteTrackerTimeToFirstByte(t *testing.T) {
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker, _ := WriteTrackerFrom(w)
+		time.Sleep(10 * time.Millisecond)
+		if tracker.TimeToFirstByte() != 0 {
+			t.Fatal("ttfb before write")
+		}
+		_, _ = w.Write([]byte("hello"))
+		ttfb := tracker.TimeToFirstByte()
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte("world"))
+		if ttfb < 10*time.Millisecond || tracker.TimeToFirstByte() != ttfb {
+			t.Fatal(ttfb)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	WithWriteTracker(endpoint).ServeHTTP(w, r)
+}